@@ -0,0 +1,79 @@
+package crudp
+
+import (
+	"time"
+)
+
+// AuditEntry is the outcome of one CallHandler call, sync or subscription packet
+type AuditEntry struct {
+	Time    int64  `json:"time"`    // Unix milliseconds
+	Actor   string `json:"actor"`   // User id from SetUserID
+	Roles   string `json:"roles"`   // Effective roles
+	Tenant  string `json:"tenant"`  // Tenant from SetTenantResolver
+	Handler string `json:"handler"` // Handler name
+	Action  byte   `json:"action"`  // 'c', 'r', 'u', 'd', or 's', '+', '-' for sync and subscriptions
+	ID      string `json:"id"`      // Entity id, when it can be resolved
+	Before  []byte `json:"before"`  // Stored entity before an update or delete (default codec), if readable
+	After   []byte `json:"after"`   // Entity after a create or update (default codec)
+	Denied  bool   `json:"denied"`  // Refused by rate limit, access check, tenant, record or field policy
+	Status  uint16 `json:"status"`  // Status code of the error, 0 if none
+	Error   string `json:"error"`   // Empty on success
+}
+
+// AuditSink receives an entry for every CallHandler call, successful or not.
+// Implementations must be safe for concurrent use; errors are logged.
+type AuditSink interface {
+	Record(e AuditEntry) error
+}
+
+// SetAuditSink enables the audit log of every handler call (reads,
+// mutations and refused calls). nil disables it.
+func (cp *CrudP) SetAuditSink(sink AuditSink) {
+	cp.auditSink = sink
+}
+
+func (cp *CrudP) newAuditEntry(handler actionHandler, action byte, data ...any) *AuditEntry {
+	e := &AuditEntry{
+		Time:    time.Now().UnixMilli(),
+		Handler: handler.name,
+		Action:  action,
+		Tenant:  cp.tenantOf(data...),
+	}
+	if cp.getUserID != nil {
+		e.Actor = cp.getUserID(data...)
+	}
+	if cp.getUserRoles != nil {
+		e.Roles = string(cp.effectiveRoles(cp.getUserRoles(data...)))
+	}
+	return e
+}
+
+// auditBefore resolves the entity id and snapshots the stored entity of an
+// update or delete
+func (cp *CrudP) auditBefore(e *AuditEntry, id string, payload any, stored *storedEntity) {
+	e.ID = entityID(id, payload, nil)
+	if entity, err := stored.load(); err == nil && entity != nil {
+		e.Before = cp.mutationData('u', nil, entity)
+	}
+}
+
+// audit completes e with the outcome and hands it to the sink
+func (cp *CrudP) audit(e *AuditEntry, result any, err error) {
+	if e.ID == "" {
+		e.ID = entityID("", nil, result)
+	}
+	if err != nil {
+		e.Status = statusOf(err)
+		e.Error = err.Error()
+	}
+	if err := cp.auditSink.Record(*e); err != nil {
+		cp.log("audit record failed:", err)
+	}
+}
+
+// deny marks the call as refused by an access decision
+func (e *AuditEntry) deny() {
+	if e != nil {
+		e.Denied = true
+	}
+}
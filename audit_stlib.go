@@ -0,0 +1,117 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// AuditFile is an append-only JSON-lines AuditSink. Each line carries the
+// hash of the previous one, so editing, removing or reordering lines breaks
+// the chain checked by VerifyAuditFile.
+type AuditFile struct {
+	mu   sync.Mutex
+	file *os.File
+	prev string
+}
+
+// auditLine is one line of an AuditFile
+type auditLine struct {
+	AuditEntry
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// OpenAuditFile opens (or creates) path for appending; the chain continues
+// from the last line already in the file.
+func OpenAuditFile(path string) (*AuditFile, error) {
+	prev, _, err := readAuditChain(path, false)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditFile{file: file, prev: prev}, nil
+}
+
+// Record appends e to the file
+func (a *AuditFile) Record(e AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	hash, err := auditHash(a.prev, e)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(auditLine{AuditEntry: e, Prev: a.prev, Hash: hash})
+	if err != nil {
+		return err
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	a.prev = hash
+	return nil
+}
+
+// Close closes the file
+func (a *AuditFile) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// VerifyAuditFile checks the hash chain of an AuditFile and returns the
+// number of entries. The error names the first line that does not match.
+func VerifyAuditFile(path string) (int, error) {
+	_, n, err := readAuditChain(path, true)
+	return n, err
+}
+
+// readAuditChain returns the last hash and line count of path. With verify,
+// every line is rehashed and linked to the previous one.
+func readAuditChain(path string, verify bool) (last string, n int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		n++
+		var line auditLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return "", n, errorf("audit line %d: %v", n, err)
+		}
+		if verify {
+			hash, err := auditHash(last, line.AuditEntry)
+			if err != nil {
+				return "", n, err
+			}
+			if line.Prev != last || line.Hash != hash {
+				return "", n, errorf("audit chain broken at line %d", n)
+			}
+		}
+		last = line.Hash
+	}
+	return last, n, scanner.Err()
+}
+
+// auditHash is hex(sha256(prev + "\n" + json(e)))
+func auditHash(prev string, e AuditEntry) (string, error) {
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(prev+"\n"), encoded...))
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,191 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+type Account struct {
+	ID      string `json:"id"`
+	Balance int    `json:"balance"`
+}
+
+var accountStore map[string]*Account
+
+// accountReads counts calls to Account.Read
+var accountReads int
+
+func (a *Account) HandlerName() string { return "accounts" }
+func (a *Account) Create(payload any) (any, error) {
+	acc := payload.(*Account)
+	accountStore[acc.ID] = acc
+	return acc, nil
+}
+func (a *Account) Read(id string) (any, error) {
+	accountReads++
+	if stored, ok := accountStore[id]; ok {
+		copied := *stored
+		return &copied, nil
+	}
+	return nil, &crudp.StatusError{Code: 404, Message: "not found"}
+}
+func (a *Account) List() (any, error) { return []*Account{}, nil }
+func (a *Account) Update(payload any) (any, error) {
+	acc := payload.(*Account)
+	accountStore[acc.ID] = acc
+	return acc, nil
+}
+func (a *Account) Delete(id string) error {
+	delete(accountStore, id)
+	return nil
+}
+func (a *Account) ValidateData(byte, any) error { return nil }
+func (a *Account) AllowedRoles(action byte) []byte {
+	if action == 'r' {
+		return []byte{'*'}
+	}
+	return []byte{'a'}
+}
+
+type memoryAudit struct{ entries []crudp.AuditEntry }
+
+func (m *memoryAudit) Record(e crudp.AuditEntry) error {
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+func TestAuditLog(t *testing.T) {
+	accountStore = map[string]*Account{}
+	roles := "a"
+	cp := NewTestCrudP()
+	cp.SetDevMode(false)
+	cp.SetUserID(func(data ...any) string { return "alice" })
+	cp.SetUserRoles(func(data ...any) []byte { return []byte(roles) })
+	if err := cp.RegisterHandlers(&Account{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	cp.RegisterRoutes(http.NewServeMux())
+
+	sink := &memoryAudit{}
+	cp.SetAuditSink(sink)
+
+	cp.CallHandler(0, 'c', &Account{ID: "1", Balance: 10})
+	cp.CallHandler(0, 'u', "1", &Account{ID: "1", Balance: 25})
+	cp.CallHandler(0, 'r', "1")
+	roles = "v"
+	cp.CallHandler(0, 'd', "1")
+
+	if len(sink.entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(sink.entries))
+	}
+
+	created := sink.entries[0]
+	if created.Actor != "alice" || created.Roles != "a" || created.Handler != "accounts" || created.Action != 'c' || created.ID != "1" {
+		t.Errorf("unexpected create entry: %+v", created)
+	}
+	if !strings.Contains(string(created.After), `"balance":10`) || created.Before != nil {
+		t.Errorf("create snapshots: before %s after %s", created.Before, created.After)
+	}
+
+	updated := sink.entries[1]
+	if updated.ID != "1" || !strings.Contains(string(updated.Before), `"balance":10`) || !strings.Contains(string(updated.After), `"balance":25`) {
+		t.Errorf("update snapshots: id %q before %s after %s", updated.ID, updated.Before, updated.After)
+	}
+	if updated.Time == 0 || updated.Status != 0 || updated.Error != "" || updated.Denied {
+		t.Errorf("unexpected update outcome: %+v", updated)
+	}
+
+	read := sink.entries[2]
+	if read.Action != 'r' || read.Before != nil || read.After != nil {
+		t.Errorf("reads carry no snapshots: %+v", read)
+	}
+
+	denied := sink.entries[3]
+	if !denied.Denied || denied.Error == "" || denied.Roles != "v" {
+		t.Errorf("expected denied delete, got %+v", denied)
+	}
+	if _, ok := accountStore["1"]; !ok {
+		t.Error("denied delete must not remove the account")
+	}
+}
+
+func TestAuditFileChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	file, err := crudp.OpenAuditFile(path)
+	if err != nil {
+		t.Fatalf("OpenAuditFile failed: %v", err)
+	}
+	file.Record(crudp.AuditEntry{Actor: "alice", Handler: "accounts", Action: 'c', ID: "1"})
+	file.Record(crudp.AuditEntry{Actor: "alice", Handler: "accounts", Action: 'u', ID: "1"})
+	file.Close()
+
+	// Reopening continues the chain
+	file, err = crudp.OpenAuditFile(path)
+	if err != nil {
+		t.Fatalf("OpenAuditFile failed: %v", err)
+	}
+	file.Record(crudp.AuditEntry{Actor: "bob", Handler: "accounts", Action: 'd', ID: "1"})
+	file.Close()
+
+	n, err := crudp.VerifyAuditFile(path)
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 valid entries, got %d: %v", n, err)
+	}
+
+	content, _ := os.ReadFile(path)
+	tampered := strings.Replace(string(content), `"actor":"bob"`, `"actor":"eve"`, 1)
+	os.WriteFile(path, []byte(tampered), 0600)
+
+	if _, err := crudp.VerifyAuditFile(path); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected broken chain at line 3, got %v", err)
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	os.WriteFile(path, []byte(lines[0]+lines[2]), 0600)
+	if _, err := crudp.VerifyAuditFile(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected removed line to break the chain, got %v", err)
+	}
+}
+
+func TestStoredEntityReadOnce(t *testing.T) {
+	accountStore = map[string]*Account{"1": {ID: "1", Balance: 10}}
+	cp := NewTestCrudP()
+	cp.SetDevMode(false)
+	cp.SetUserID(func(data ...any) string { return "alice" })
+	cp.SetUserRoles(func(data ...any) []byte { return []byte("a") })
+	cp.SetAccessPolicies(crudp.AllOf, crudp.StaticRoles(), crudp.RecordOwner(func(record any) string { return "alice" }))
+	if err := cp.RegisterHandlers(&Account{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	cp.RegisterRoutes(http.NewServeMux())
+	sink := &memoryAudit{}
+	cp.SetAuditSink(sink)
+
+	read, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'r', ReqID: "r1"}}}, "1")
+	tag := read.Results[0].Version
+	if tag == "" {
+		t.Fatalf("expected a version from the read, got %+v", read.Results[0])
+	}
+
+	accountReads = 0
+	var data []byte
+	jsonEncode(&Account{ID: "1", Balance: 20}, &data)
+	resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'u', ReqID: "u1", Version: tag, Data: [][]byte{data}}}})
+	if res := resp.Results[0]; res.Message != "OK" {
+		t.Fatalf("update failed: %+v", res)
+	}
+	if accountReads != 1 {
+		t.Errorf("expected the stored account read once, got %d reads", accountReads)
+	}
+	if entry := sink.entries[len(sink.entries)-1]; !strings.Contains(string(entry.Before), `"balance":10`) {
+		t.Errorf("expected the audit snapshot from the single read, got %s", entry.Before)
+	}
+}
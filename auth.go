@@ -0,0 +1,58 @@
+package crudp
+
+import (
+	"github.com/tinywasm/context"
+)
+
+// Context keys holding the caller authenticated by SetAuthenticator
+const (
+	UserIDKey = "crudp.user"
+	RolesKey  = "crudp.roles"
+)
+
+// Identity is an authenticated caller
+type Identity struct {
+	UserID string
+	Roles  []byte
+}
+
+// ContextUserID returns the UserIDKey of the injected context. It is the
+// default SetUserID resolver when an authenticator is set.
+func ContextUserID(data ...any) string {
+	return contextFrom(data).Value(UserIDKey)
+}
+
+// ContextRoles returns the RolesKey of the injected context. It is the
+// default SetUserRoles resolver when an authenticator is set.
+func ContextRoles(data ...any) []byte {
+	if roles := contextFrom(data).Value(RolesKey); roles != "" {
+		return []byte(roles)
+	}
+	return nil
+}
+
+// callerData prepends a context carrying a caller (user id, roles, tenant)
+// to data, unless data has one. It stands in for the request when access
+// is evaluated outside of it.
+func callerData(userID string, roles []byte, tenant string, data []any) []any {
+	if contextFrom(data) != nil {
+		return data
+	}
+	ctx := context.Background()
+	ctx.Set(UserIDKey, userID)
+	ctx.Set(RolesKey, string(roles))
+	if tenant != "" {
+		ctx.Set(TenantKey, tenant)
+	}
+	return append([]any{ctx}, data...)
+}
+
+// contextFrom returns the injected context, or nil
+func contextFrom(data []any) *context.Context {
+	for _, d := range data {
+		if ctx, ok := d.(*context.Context); ok {
+			return ctx
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"net/http"
+
+	"github.com/tinywasm/context"
+	. "github.com/tinywasm/fmt"
+)
+
+// Authenticator resolves the caller of a request. It returns nil, nil when
+// the request carries none of its credentials, and an error when they are
+// invalid or expired, which is answered with 401.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// SetAuthenticator authenticates every HTTP request with the first
+// authenticator that finds credentials, and stores the identity under
+// UserIDKey and RolesKey in the injected context. SetUserID and SetUserRoles
+// default to ContextUserID and ContextRoles unless already configured.
+// Access denials then report 401 to anonymous callers and 403 to others.
+func (cp *CrudP) SetAuthenticator(authenticators ...Authenticator) {
+	cp.authenticate = func(data ...any) (*Identity, error) {
+		r := requestFrom(data)
+		if r == nil {
+			return nil, nil
+		}
+		for _, a := range authenticators {
+			if id, err := a.Authenticate(r); err != nil || id != nil {
+				return id, err
+			}
+		}
+		return nil, nil
+	}
+	if cp.getUserID == nil {
+		cp.getUserID = ContextUserID
+	}
+	if cp.getUserRoles == nil {
+		cp.getUserRoles = ContextRoles
+	}
+}
+
+// authenticateRequest stores the identity of r in ctx
+func (cp *CrudP) authenticateRequest(ctx *context.Context, r *http.Request) error {
+	if cp.authenticate == nil {
+		return nil
+	}
+	id, err := cp.authenticate(ctx, r)
+	if err != nil {
+		return err
+	}
+	if id != nil && id.UserID != "" {
+		ctx.Set(UserIDKey, id.UserID)
+		ctx.Set(RolesKey, string(id.Roles))
+	}
+	return nil
+}
+
+// deniedError is the error of a failed access check: without an
+// authenticator a generic error, otherwise 401 for anonymous callers and 403
+func (cp *CrudP) deniedError(data ...any) error {
+	if cp.authenticate == nil {
+		return Errf("access denied")
+	}
+	if ContextUserID(data...) == "" {
+		return &StatusError{Code: 401, Message: "authentication required"}
+	}
+	return &StatusError{Code: 403, Message: "access denied"}
+}
@@ -0,0 +1,115 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/crudp"
+)
+
+func newAuthServer(t *testing.T, authenticators ...crudp.Authenticator) *http.ServeMux {
+	cp := NewTestCrudP()
+	cp.SetDevMode(false)
+	cp.SetAuthenticator(authenticators...)
+	if err := cp.RegisterHandlers(&RestrictedResource{}); err != nil { // Requires 'a'
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	cp.RegisterRoutes(mux)
+	return mux
+}
+
+func TestJWT(t *testing.T) {
+	jwt := &crudp.JWT{Secret: []byte("test-secret"), RoleMap: map[string]byte{"admin": 'a', "visitor": 'v'}}
+	mux := newAuthServer(t, jwt)
+
+	token := func(claims map[string]any) string {
+		signed, err := jwt.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	get := func(bearer string) int {
+		req := httptest.NewRequest("GET", "/restricted/", nil)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	if code := get(token(map[string]any{"sub": "1", "roles": []string{"admin"}, "exp": exp})); code != http.StatusOK {
+		t.Errorf("admin token: expected 200, got %d", code)
+	}
+	if code := get(token(map[string]any{"sub": "2", "roles": "visitor", "exp": exp})); code != http.StatusForbidden {
+		t.Errorf("visitor token: expected 403, got %d", code)
+	}
+	if code := get(""); code != http.StatusUnauthorized {
+		t.Errorf("anonymous: expected 401, got %d", code)
+	}
+	if code := get(token(map[string]any{"sub": "1", "roles": []string{"admin"}, "exp": time.Now().Add(-time.Minute).Unix()})); code != http.StatusUnauthorized {
+		t.Errorf("expired token: expected 401, got %d", code)
+	}
+
+	forged := token(map[string]any{"sub": "2", "roles": []string{"visitor"}, "exp": exp})
+	admin := token(map[string]any{"sub": "2", "roles": []string{"admin"}, "exp": exp})
+	if code := get(forged[:len(forged)-43] + admin[len(admin)-43:]); code != http.StatusUnauthorized {
+		t.Errorf("token with a foreign signature: expected 401, got %d", code)
+	}
+
+	other := &crudp.JWT{Secret: []byte("other-secret")}
+	wrong, _ := other.Sign(map[string]any{"sub": "1", "roles": []string{"a"}, "exp": exp})
+	if code := get(wrong); code != http.StatusUnauthorized {
+		t.Errorf("token of another secret: expected 401, got %d", code)
+	}
+}
+
+func TestCookieSession(t *testing.T) {
+	session := &crudp.CookieSession{Secret: []byte("test-secret")}
+	mux := newAuthServer(t, session)
+
+	issue := func(id crudp.Identity) *http.Cookie {
+		rec := httptest.NewRecorder()
+		if err := session.Issue(rec, id); err != nil {
+			t.Fatal(err)
+		}
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 || !cookies[0].HttpOnly || !cookies[0].Secure {
+			t.Fatalf("expected one HttpOnly, Secure cookie, got %+v", cookies)
+		}
+		return cookies[0]
+	}
+	get := func(cookie *http.Cookie) int {
+		req := httptest.NewRequest("GET", "/restricted/", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := get(issue(crudp.Identity{UserID: "1", Roles: []byte{'a'}})); code != http.StatusOK {
+		t.Errorf("admin session: expected 200, got %d", code)
+	}
+	if code := get(issue(crudp.Identity{UserID: "2", Roles: []byte{'v'}})); code != http.StatusForbidden {
+		t.Errorf("visitor session: expected 403, got %d", code)
+	}
+	if code := get(nil); code != http.StatusUnauthorized {
+		t.Errorf("no session: expected 401, got %d", code)
+	}
+
+	tampered := issue(crudp.Identity{UserID: "2", Roles: []byte{'v'}})
+	admin := issue(crudp.Identity{UserID: "2", Roles: []byte{'a'}})
+	tampered.Value = admin.Value[:len(admin.Value)-43] + tampered.Value[len(tampered.Value)-43:]
+	if code := get(tampered); code != http.StatusUnauthorized {
+		t.Errorf("tampered session: expected 401, got %d", code)
+	}
+}
@@ -0,0 +1,283 @@
+package crudp
+
+import (
+	"encoding/binary"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// MIMEBinary is the content type of the binary envelope
+const MIMEBinary = "application/x-crudp"
+
+// binaryVersion is the first byte of every encoded BatchRequest/BatchResponse
+const binaryVersion byte = 1
+
+// EncodeBinary encodes a protocol envelope into *[]byte using the compact
+// binary format: varints for numbers, length-prefixed strings and data
+// items, no field names. input is a BatchRequest, BatchResponse, Packet or
+// PacketResult (value or pointer). Entities inside Data stay as produced by
+// the entity codec, so the envelope format is independent of SetCodecs.
+func EncodeBinary(input any, output any) error {
+	out, ok := output.(*[]byte)
+	if !ok {
+		return Errf("binary output must be *[]byte")
+	}
+
+	var buf []byte
+	switch v := input.(type) {
+	case *BatchRequest:
+		buf = appendBatchRequest(buf, v)
+	case BatchRequest:
+		buf = appendBatchRequest(buf, &v)
+	case *BatchResponse:
+		buf = appendBatchResponse(buf, v)
+	case BatchResponse:
+		buf = appendBatchResponse(buf, &v)
+	case *Packet:
+		buf = appendPacket(buf, v)
+	case Packet:
+		buf = appendPacket(buf, &v)
+	case *PacketResult:
+		buf = appendPacketResult(buf, v)
+	case PacketResult:
+		buf = appendPacketResult(buf, &v)
+	default:
+		return Errf("binary codec does not support this type")
+	}
+
+	*out = buf
+	return nil
+}
+
+// DecodeBinary decodes data produced by EncodeBinary. input is []byte and
+// output a *BatchRequest, *BatchResponse, *Packet or *PacketResult.
+// Malformed or truncated input returns an error, never panics.
+func DecodeBinary(input any, output any) error {
+	data, ok := input.([]byte)
+	if !ok {
+		return Errf("binary input must be []byte")
+	}
+
+	r := &binaryReader{buf: data}
+	switch v := output.(type) {
+	case *BatchRequest:
+		r.readBatchRequest(v)
+	case *BatchResponse:
+		r.readBatchResponse(v)
+	case *Packet:
+		r.readPacket(v)
+	case *PacketResult:
+		r.readPacketResult(v)
+	default:
+		return Errf("binary codec does not support this type")
+	}
+
+	if r.err == nil && r.pos != len(r.buf) {
+		r.err = errorf("binary: %d trailing bytes", len(r.buf)-r.pos)
+	}
+	return r.err
+}
+
+// IsBinaryContentType reports whether a Content-Type/Accept value selects
+// the binary envelope
+func IsBinaryContentType(value string) bool {
+	for _, part := range Split(value, ",") {
+		mime := Split(part, ";")[0]
+		if Convert(mime).TrimSpace().String() == MIMEBinary {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeEnvelope decodes a batch envelope with the binary format or codec c
+func decodeEnvelope(c Codec, isBinary bool, body []byte, out any) error {
+	if isBinary {
+		return DecodeBinary(body, out)
+	}
+	if c.Decode == nil {
+		return Errf("decode function not configured")
+	}
+	return c.Decode(body, out)
+}
+
+// encodeEnvelope encodes a batch envelope with the binary format or codec c
+func encodeEnvelope(c Codec, isBinary bool, in any) ([]byte, error) {
+	var encoded []byte
+	if isBinary {
+		err := EncodeBinary(in, &encoded)
+		return encoded, err
+	}
+	if c.Encode == nil {
+		return nil, Errf("encode function not configured")
+	}
+	err := c.Encode(in, &encoded)
+	return encoded, err
+}
+
+func appendBatchRequest(buf []byte, req *BatchRequest) []byte {
+	buf = append(buf, binaryVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(req.Packets)))
+	for i := range req.Packets {
+		buf = appendPacket(buf, &req.Packets[i])
+	}
+	return buf
+}
+
+func appendBatchResponse(buf []byte, resp *BatchResponse) []byte {
+	buf = append(buf, binaryVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(resp.Results)))
+	for i := range resp.Results {
+		buf = appendPacketResult(buf, &resp.Results[i])
+	}
+	return buf
+}
+
+func appendPacket(buf []byte, p *Packet) []byte {
+	buf = append(buf, p.Action, p.HandlerID)
+	buf = appendString(buf, p.ReqID)
+	buf = binary.AppendUvarint(buf, uint64(len(p.Data)))
+	for _, item := range p.Data {
+		buf = binary.AppendUvarint(buf, uint64(len(item)))
+		buf = append(buf, item...)
+	}
+	buf = appendString(buf, p.IdempotencyKey)
+	buf = appendString(buf, p.Version)
+	return binary.AppendUvarint(buf, p.Cursor)
+}
+
+func appendPacketResult(buf []byte, pr *PacketResult) []byte {
+	buf = appendPacket(buf, &pr.Packet)
+	buf = append(buf, pr.MessageType)
+	buf = appendString(buf, pr.Message)
+	buf = binary.AppendUvarint(buf, uint64(pr.Status))
+	return appendString(buf, pr.Resolution)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// binaryReader consumes an encoded envelope, keeping the first error
+type binaryReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *binaryReader) fail(what string) {
+	if r.err == nil {
+		r.err = errorf("binary: truncated or invalid %s at offset %d", what, r.pos)
+	}
+}
+
+func (r *binaryReader) u8(what string) byte {
+	if r.err != nil || r.pos >= len(r.buf) {
+		r.fail(what)
+		return 0
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *binaryReader) uvarint(what string) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		r.fail(what)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// count reads a collection length; each element takes at least minSize
+// bytes, which bounds allocations on hostile input
+func (r *binaryReader) count(what string, minSize int) int {
+	n := r.uvarint(what)
+	if r.err != nil {
+		return 0
+	}
+	if n > uint64((len(r.buf)-r.pos)/minSize) {
+		r.fail(what)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *binaryReader) bytes(what string) []byte {
+	n := r.uvarint(what)
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.buf)-r.pos) {
+		r.fail(what)
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, r.buf[r.pos:])
+	r.pos += int(n)
+	return b
+}
+
+func (r *binaryReader) str(what string) string {
+	return string(r.bytes(what))
+}
+
+func (r *binaryReader) version() {
+	if v := r.u8("version"); r.err == nil && v != binaryVersion {
+		r.err = errorf("binary: unsupported version %d", v)
+	}
+}
+
+// Smallest encoded Packet: action, handler id and five empty varints
+const minPacketSize = 7
+
+func (r *binaryReader) readBatchRequest(req *BatchRequest) {
+	r.version()
+	n := r.count("packet count", minPacketSize)
+	req.Packets = make([]Packet, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		r.readPacket(&req.Packets[i])
+	}
+}
+
+func (r *binaryReader) readBatchResponse(resp *BatchResponse) {
+	r.version()
+	n := r.count("result count", minPacketSize+4)
+	resp.Results = make([]PacketResult, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		r.readPacketResult(&resp.Results[i])
+	}
+}
+
+func (r *binaryReader) readPacket(p *Packet) {
+	p.Action = r.u8("action")
+	p.HandlerID = r.u8("handler id")
+	p.ReqID = r.str("req id")
+	if n := r.count("data count", 1); n > 0 {
+		p.Data = make([][]byte, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			p.Data[i] = r.bytes("data item")
+		}
+	}
+	p.IdempotencyKey = r.str("idempotency key")
+	p.Version = r.str("version")
+	p.Cursor = r.uvarint("cursor")
+}
+
+func (r *binaryReader) readPacketResult(pr *PacketResult) {
+	r.readPacket(&pr.Packet)
+	pr.MessageType = r.u8("message type")
+	pr.Message = r.str("message")
+	status := r.uvarint("status")
+	if status > 0xFFFF {
+		r.fail("status")
+	}
+	pr.Status = uint16(status)
+	pr.Resolution = r.str("resolution")
+}
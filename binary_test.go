@@ -0,0 +1,105 @@
+package crudp_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+func sampleBatchResponse() *crudp.BatchResponse {
+	return &crudp.BatchResponse{Results: []crudp.PacketResult{
+		{
+			Packet: crudp.Packet{
+				Action: 'u', HandlerID: 3, ReqID: "u1",
+				Data:           [][]byte{[]byte(`{"id":"1"}`), {0, 1, 2}},
+				IdempotencyKey: "k1", Version: `"4"`, Cursor: 1 << 40,
+			},
+			MessageType: 4, Message: "OK", Status: 412, Resolution: "merged",
+		},
+		{Packet: crudp.Packet{Action: 's', Cursor: 7}},
+	}}
+}
+
+func TestBinaryEnvelope(t *testing.T) {
+	t.Run("Round Trip", func(t *testing.T) {
+		in := sampleBatchResponse()
+		var encoded []byte
+		if err := crudp.EncodeBinary(in, &encoded); err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+
+		var out crudp.BatchResponse
+		if err := crudp.DecodeBinary(encoded, &out); err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if !reflect.DeepEqual(in, &out) {
+			t.Errorf("round trip mismatch:\n in: %+v\nout: %+v", in, out)
+		}
+
+		var jsonEncoded []byte
+		jsonEncode(in, &jsonEncoded)
+		if len(encoded) >= len(jsonEncoded)/2 {
+			t.Errorf("binary envelope not compact: %d bytes vs %d JSON", len(encoded), len(jsonEncoded))
+		}
+
+		req := &crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', ReqID: "c1", Data: [][]byte{[]byte("x")}}}}
+		var reqOut crudp.BatchRequest
+		crudp.EncodeBinary(req, &encoded)
+		if err := crudp.DecodeBinary(encoded, &reqOut); err != nil || !reflect.DeepEqual(req, &reqOut) {
+			t.Errorf("request round trip mismatch: %+v (%v)", reqOut, err)
+		}
+	})
+
+	t.Run("Truncated Input", func(t *testing.T) {
+		var encoded []byte
+		crudp.EncodeBinary(sampleBatchResponse(), &encoded)
+		for i := 0; i < len(encoded); i++ {
+			var out crudp.BatchResponse
+			if err := crudp.DecodeBinary(encoded[:i], &out); err == nil {
+				t.Fatalf("expected error for input truncated at %d", i)
+			}
+		}
+
+		var out crudp.BatchResponse
+		err := crudp.DecodeBinary(append(encoded, 0, 0), &out)
+		if err == nil || err.Error() != "binary: 2 trailing bytes" {
+			t.Errorf("expected formatted trailing bytes error, got %v", err)
+		}
+	})
+
+	t.Run("Unsupported Types", func(t *testing.T) {
+		var out []byte
+		if err := crudp.EncodeBinary("text", &out); err == nil {
+			t.Error("expected error encoding a string")
+		}
+		if err := crudp.DecodeBinary([]byte{1, 0}, &out); err == nil {
+			t.Error("expected error decoding into *[]byte")
+		}
+	})
+}
+
+func FuzzDecodeBinary(f *testing.F) {
+	var encoded []byte
+	crudp.EncodeBinary(sampleBatchResponse(), &encoded)
+	f.Add(encoded)
+	crudp.EncodeBinary(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'r', ReqID: "r1"}}}, &encoded)
+	f.Add(encoded)
+	f.Add([]byte{1, 0xff, 0xff, 0xff, 0xff, 0x0f})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var resp crudp.BatchResponse
+		if err := crudp.DecodeBinary(data, &resp); err == nil {
+			var again []byte
+			if err := crudp.EncodeBinary(&resp, &again); err != nil {
+				t.Fatalf("re-encode failed: %v", err)
+			}
+			var resp2 crudp.BatchResponse
+			if err := crudp.DecodeBinary(again, &resp2); err != nil {
+				t.Fatalf("decoding re-encoded response failed: %v", err)
+			}
+		}
+		var req crudp.BatchRequest
+		crudp.DecodeBinary(data, &req)
+	})
+}
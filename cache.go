@@ -0,0 +1,189 @@
+package crudp
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// CacheStore stores encoded results (PacketResult.Data) by key.
+// Implementations must be safe for concurrent use. LRUCache is the default.
+type CacheStore interface {
+	Get(key string) ([][]byte, bool)
+	Set(key string, data [][]byte)
+	DeletePrefix(prefix string)
+}
+
+// cachedResult is an already encoded handler result and its ETag.
+// encodeResult copies the data as is.
+type cachedResult struct {
+	data [][]byte
+	tag  string
+}
+
+// cachedRead serves a read from the server cache, filling it on a miss.
+// Keys are scoped by handler, id and the caller's role set so that results
+// are never shared between users with different permissions, and by the
+// response codec.
+func (cp *CrudP) cachedRead(handler actionHandler, id string, policy *callPolicy, data ...any) (any, error) {
+	var roles []byte
+	if cp.getUserRoles != nil {
+		roles = cp.getUserRoles(data...)
+	}
+	codec := cp.codecFrom(data).out
+	key := serverCacheKey(handler.name, cp.tenantOf(data...), id, roles, codec.MIME)
+
+	// Entries hold the ETag first, then the encoded data
+	if entry, ok := cp.cache.Get(key); ok && len(entry) > 0 {
+		return cachedResult{data: entry[1:], tag: string(entry[0])}, nil
+	}
+
+	result, err := handler.read(id)
+	if err != nil || result == nil {
+		return result, err
+	}
+	// Entries are per role set, so hidden fields are stripped before caching
+	if policy != nil && policy.access {
+		result = handler.stripFields(policy.roles, result)
+	}
+
+	var pr PacketResult
+	if err := cp.encodeResult(&pr, result, codec); err != nil {
+		return result, nil
+	}
+	tag := resultTag(result, pr.Data)
+	cp.cache.Set(key, append([][]byte{[]byte(tag)}, pr.Data...))
+	return cachedResult{data: pr.Data, tag: tag}, nil
+}
+
+// serverCacheKey builds "handler|tenant|id|roles|mime" with roles sorted and deduplicated
+func serverCacheKey(handler, tenant, id string, roles []byte, mime string) string {
+	var set [256]bool
+	for _, r := range roles {
+		set[r] = true
+	}
+	sorted := make([]byte, 0, len(roles))
+	for r := 0; r < len(set); r++ {
+		if set[r] {
+			sorted = append(sorted, byte(r))
+		}
+	}
+	return handler + "|" + tenant + "|" + id + "|" + string(sorted) + "|" + mime
+}
+
+// LRUCache is an in-memory, size-bounded cache of encoded results with an
+// optional time-to-live. It is safe for concurrent use.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List // Front = most recently used
+	items    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	data    [][]byte
+	expires time.Time
+}
+
+// NewLRUCache creates a cache holding up to capacity entries (<= 0 means 1024).
+// ttlMs is the lifetime of each entry in milliseconds (0 = no expiry).
+func NewLRUCache(capacity, ttlMs int) *LRUCache {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	return &LRUCache{
+		capacity: capacity,
+		ttl:      time.Duration(ttlMs) * time.Millisecond,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the data stored under key if present and not expired.
+func (c *LRUCache) Get(key string) ([][]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.data, true
+}
+
+// Set stores data under key, evicting the least recently used entry when full.
+func (c *LRUCache) Set(key string, data [][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.data = data
+		entry.expires = expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, data: data, expires: expires})
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+// Delete removes the entry stored under key.
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// DeletePrefix removes every entry whose key starts with prefix.
+func (c *LRUCache) DeletePrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, el := range c.items {
+		if HasPrefix(key, prefix) {
+			c.remove(el)
+		}
+	}
+}
+
+// Clear removes all entries.
+func (c *LRUCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Len returns the number of stored entries, including expired ones not yet evicted.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRUCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*lruEntry).key)
+}
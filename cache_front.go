@@ -0,0 +1,128 @@
+//go:build wasm
+
+package crudp
+
+import (
+	. "github.com/tinywasm/fmt"
+)
+
+// SetClientCache enables the client read cache. Successful read results are
+// stored per handler and request data (id or query) and served locally by Send
+// until they expire (ttlMs, 0 = never) or a create/update/delete result for the
+// same handler arrives. capacity <= 0 means 1024 entries.
+func (cp *CrudP) SetClientCache(capacity, ttlMs int) {
+	cp.readCache = NewLRUCache(capacity, ttlMs)
+}
+
+// InvalidateCache drops every cached read of a handler.
+func (cp *CrudP) InvalidateCache(handlerID uint8) {
+	if cp.readCache != nil {
+		cp.readCache.DeletePrefix(handlerCachePrefix(handlerID))
+	}
+}
+
+// InvalidateCacheEntry drops the cached read for a specific handler and request data.
+func (cp *CrudP) InvalidateCacheEntry(handlerID uint8, data [][]byte) {
+	if cp.readCache != nil {
+		cp.readCache.Delete(clientCacheKey(handlerID, data))
+	}
+}
+
+// ClearCache drops every cached read.
+func (cp *CrudP) ClearCache() {
+	if cp.readCache != nil {
+		cp.readCache.Clear()
+	}
+}
+
+// serveCachedReads answers read packets from the cache and returns the
+// packets that still have to reach the server. Reads that miss are
+// remembered so their results can populate the cache. Reads after a
+// mutation of the same handler in the batch must see it: they go to the
+// server and their results are not cached.
+func (cp *CrudP) serveCachedReads(req *BatchRequest) *BatchRequest {
+	if cp.readCache == nil {
+		return req
+	}
+
+	remaining := make([]Packet, 0, len(req.Packets))
+	var hits []PacketResult
+	mutated := map[uint8]bool{}
+
+	for _, p := range req.Packets {
+		if p.Action != 'r' {
+			if p.Action == 'c' || p.Action == 'u' || p.Action == 'd' {
+				mutated[p.HandlerID] = true
+			}
+			remaining = append(remaining, p)
+			continue
+		}
+		if mutated[p.HandlerID] {
+			remaining = append(remaining, p)
+			continue
+		}
+
+		key := clientCacheKey(p.HandlerID, p.Data)
+		if data, ok := cp.readCache.Get(key); ok {
+			hit := PacketResult{Packet: p, MessageType: uint8(Msg.Success), Message: "OK"}
+			hit.Data = data
+			hits = append(hits, hit)
+			continue
+		}
+
+		if p.ReqID != "" {
+			cp.clientMu.Lock()
+			if cp.readKeys == nil {
+				cp.readKeys = make(map[string]string)
+			}
+			cp.readKeys[p.ReqID] = key
+			cp.clientMu.Unlock()
+		}
+		remaining = append(remaining, p)
+	}
+
+	if len(hits) > 0 {
+		cp.HandleResponse(&BatchResponse{Results: hits})
+	}
+	return &BatchRequest{Packets: remaining}
+}
+
+// updateCache stores successful read results and invalidates a handler's
+// reads when one of its mutations succeeds (sent locally or pushed).
+func (cp *CrudP) updateCache(res *PacketResult) {
+	if cp.readCache == nil {
+		return
+	}
+
+	cp.clientMu.Lock()
+	key, tracked := cp.readKeys[res.ReqID]
+	if tracked {
+		delete(cp.readKeys, res.ReqID)
+	}
+	cp.clientMu.Unlock()
+
+	if res.MessageType != uint8(Msg.Success) {
+		return
+	}
+
+	switch res.Action {
+	case 'r':
+		if tracked {
+			cp.readCache.Set(key, res.Data)
+		}
+	case 'c', 'u', 'd':
+		cp.InvalidateCache(res.HandlerID)
+	}
+}
+
+func handlerCachePrefix(handlerID uint8) string {
+	return Sprintf("%d|", handlerID)
+}
+
+func clientCacheKey(handlerID uint8, data [][]byte) string {
+	key := handlerCachePrefix(handlerID)
+	for _, item := range data {
+		key += string(item) + "\x00"
+	}
+	return key
+}
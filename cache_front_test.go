@@ -0,0 +1,62 @@
+//go:build wasm
+
+package crudp_test
+
+import (
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+func TestClientReadCache(t *testing.T) {
+	noteStore = map[string]*Note{"1": {ID: "1", Rev: 1}}
+	cp := NewTestCrudP()
+	cp.SetClientCache(10, 0)
+	if err := cp.RegisterHandlers(&Note{}, &Draft{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	read := func(reqID string, handlerID uint8) crudp.Packet {
+		return crudp.Packet{Action: 'r', HandlerID: handlerID, ReqID: reqID, Data: [][]byte{[]byte("1")}}
+	}
+	answer := func(p crudp.Packet, ok bool) {
+		res := crudp.PacketResult{Packet: p, MessageType: 4, Message: "OK"}
+		if !ok {
+			res.MessageType, res.Message = 2, "failed"
+		}
+		res.Data = [][]byte{[]byte(`{"id":"1","rev":1}`)}
+		cp.UpdateCache(&res)
+	}
+	served := func(req *crudp.BatchRequest) []string {
+		var sent []string
+		for _, p := range cp.ServeCachedReads(req).Packets {
+			sent = append(sent, p.ReqID)
+		}
+		return sent
+	}
+
+	// A failed read is not cached
+	served(&crudp.BatchRequest{Packets: []crudp.Packet{read("r1", 0)}})
+	answer(read("r1", 0), false)
+	if sent := served(&crudp.BatchRequest{Packets: []crudp.Packet{read("r2", 0)}}); len(sent) != 1 {
+		t.Fatalf("expected a miss after a failed read, sent %q", sent)
+	}
+	answer(read("r2", 0), true)
+	if sent := served(&crudp.BatchRequest{Packets: []crudp.Packet{read("r3", 0)}}); len(sent) != 0 {
+		t.Errorf("expected the read served from the cache, sent %q", sent)
+	}
+
+	// Reads after a mutation of the same handler in the batch reach the server
+	update := crudp.Packet{Action: 'u', HandlerID: 0, ReqID: "u1"}
+	sent := served(&crudp.BatchRequest{Packets: []crudp.Packet{read("r4", 0), update, read("r5", 0), read("r6", 1)}})
+	if len(sent) != 3 || sent[0] != "u1" || sent[1] != "r5" || sent[2] != "r6" {
+		t.Errorf("expected the update and the read after it sent, got %q", sent)
+	}
+
+	// A confirmed mutation drops the handler's reads
+	answer(read("r6", 1), true)
+	cp.UpdateCache(&crudp.PacketResult{Packet: update, MessageType: 4, Message: "OK"})
+	sent = served(&crudp.BatchRequest{Packets: []crudp.Packet{read("r7", 0), read("r8", 1)}})
+	if len(sent) != 1 || sent[0] != "r7" {
+		t.Errorf("expected only the mutated handler's read sent, got %q", sent)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+func TestServerReadCache(t *testing.T) {
+	notes := &CachedNotes{}
+	roles := []byte{'a'}
+
+	cp := NewTestCrudP()
+	cp.SetUserRoles(func(data ...any) []byte { return roles })
+	if err := cp.RegisterHandlers(notes); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	cp.RegisterRoutes(http.NewServeMux())
+
+	read := func(id string) *crudp.BatchResponse {
+		req := &crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'r', HandlerID: 0, ReqID: "r1"}}}
+		resp, err := cp.Execute(req, id)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		return resp
+	}
+
+	first := read("7")
+	second := read("7")
+	if notes.reads != 1 {
+		t.Errorf("expected 1 handler read, got %d", notes.reads)
+	}
+	if string(first.Results[0].Data[0]) != string(second.Results[0].Data[0]) {
+		t.Error("cached result differs from original")
+	}
+
+	read("")
+	if notes.reads != 2 {
+		t.Errorf("expected List to be cached separately, got %d reads", notes.reads)
+	}
+
+	roles = []byte{'v'}
+	read("7")
+	if notes.reads != 3 {
+		t.Errorf("expected a separate entry per role set, got %d reads", notes.reads)
+	}
+
+	if _, err := cp.CallHandler(0, 'c', &CachedNote{ID: 3}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	roles = []byte{'a'}
+	read("7")
+	if notes.reads != 4 {
+		t.Errorf("expected create to invalidate cached reads, got %d reads", notes.reads)
+	}
+}
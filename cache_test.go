@@ -0,0 +1,82 @@
+package crudp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tinywasm/crudp"
+)
+
+func TestLRUCache(t *testing.T) {
+	t.Run("Evicts Least Recently Used", func(t *testing.T) {
+		c := crudp.NewLRUCache(2, 0)
+		c.Set("a", [][]byte{[]byte("1")})
+		c.Set("b", [][]byte{[]byte("2")})
+		c.Get("a") // "b" becomes the oldest
+		c.Set("c", [][]byte{[]byte("3")})
+
+		if _, ok := c.Get("b"); ok {
+			t.Error("expected 'b' to be evicted")
+		}
+		if _, ok := c.Get("a"); !ok {
+			t.Error("expected 'a' to be kept")
+		}
+	})
+
+	t.Run("Expires After TTL", func(t *testing.T) {
+		c := crudp.NewLRUCache(10, 10)
+		c.Set("a", [][]byte{[]byte("1")})
+		time.Sleep(20 * time.Millisecond)
+		if _, ok := c.Get("a"); ok {
+			t.Error("expected entry to expire")
+		}
+	})
+
+	t.Run("Delete Prefix", func(t *testing.T) {
+		c := crudp.NewLRUCache(10, 0)
+		c.Set("0|a", nil)
+		c.Set("0|b", nil)
+		c.Set("1|a", nil)
+		c.DeletePrefix("0|")
+		if c.Len() != 1 {
+			t.Errorf("expected 1 entry left, got %d", c.Len())
+		}
+	})
+}
+
+type CachedNote struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+}
+
+type CachedNotes struct{ reads int }
+
+func (n *CachedNotes) HandlerName() string { return "notes" }
+func (n *CachedNotes) CacheReads() bool    { return true }
+func (n *CachedNotes) Read(id string) (any, error) {
+	n.reads++
+	return &CachedNote{ID: 1, Text: "note " + id}, nil
+}
+func (n *CachedNotes) List() (any, error) {
+	n.reads++
+	return []*CachedNote{{ID: 1}, {ID: 2}}, nil
+}
+func (n *CachedNotes) Create(payload any) (any, error)             { return payload, nil }
+func (n *CachedNotes) ValidateData(action byte, payload any) error { return nil }
+func (n *CachedNotes) AllowedRoles(action byte) []byte             { return []byte{'*'} }
+
+func TestServerCacheSkippedWithoutRoutes(t *testing.T) {
+	notes := &CachedNotes{}
+	cp := NewTestCrudP()
+	if err := cp.RegisterHandlers(notes); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+
+	// Without RegisterRoutes (e.g. the WASM client replaying results),
+	// every read reaches the handler
+	cp.CallHandler(0, 'r', "7")
+	cp.CallHandler(0, 'r', "7")
+	if notes.reads != 2 {
+		t.Errorf("expected 2 handler reads, got %d", notes.reads)
+	}
+}
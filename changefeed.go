@@ -0,0 +1,285 @@
+package crudp
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Change is a successful create, update or delete recorded in the change feed.
+type Change struct {
+	Seq     uint64 `json:"seq"`     // Monotonic sequence number assigned by the ChangeLog
+	Handler string `json:"handler"` // Handler (resource) name
+	Action  byte   `json:"action"`  // 'c', 'u' or 'd'
+	ID      string `json:"id"`      // Entity id, when it can be resolved
+	Data    []byte `json:"data"`    // Encoded entity; for deletes the entity as stored before, omitted by GET /changes
+	Time    int64  `json:"time"`    // Unix milliseconds
+	Actor   string `json:"actor"`   // User id from SetUserID, empty if not configured
+	Tenant  string `json:"tenant"`  // Tenant from SetTenantResolver, empty if not configured
+}
+
+// ChangeFeed is the response of the GET /changes endpoint.
+type ChangeFeed struct {
+	Changes []Change `json:"changes"`
+	Cursor  uint64   `json:"cursor"` // Pass as ?since= to continue reading
+}
+
+// ChangeLog persists the change feed. Append assigns and returns the sequence
+// number of the change; Since returns up to limit changes with Seq > seq in
+// order (limit <= 0 means no limit). Logs that discard old changes return a
+// *CursorExpiredError from Since when changes after seq are gone.
+// Implementations must be safe for concurrent use.
+type ChangeLog interface {
+	Append(c Change) (uint64, error)
+	Since(seq uint64, limit int) ([]Change, error)
+}
+
+// CursorExpiredError reports a cursor older than the changes still kept:
+// the reader missed changes and must reload everything (status 410).
+type CursorExpiredError struct {
+	Oldest uint64 // Oldest sequence number still kept
+}
+
+func (e *CursorExpiredError) Error() string { return "cursor expired: full resync required" }
+
+// StatusCode returns 410 Gone
+func (e *CursorExpiredError) StatusCode() uint16 { return 410 }
+
+// MemoryChangeLog is an in-memory ChangeLog keeping the most recent changes.
+type MemoryChangeLog struct {
+	mu       sync.Mutex
+	capacity int
+	last     uint64
+	changes  []Change
+}
+
+// NewMemoryChangeLog creates a log that keeps up to capacity changes
+// (<= 0 means 10000); older changes are discarded.
+func NewMemoryChangeLog(capacity int) *MemoryChangeLog {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &MemoryChangeLog{capacity: capacity}
+}
+
+// Append stores c with the next sequence number
+func (l *MemoryChangeLog) Append(c Change) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.last++
+	c.Seq = l.last
+	l.changes = append(l.changes, c)
+	// Trimmed in chunks so appends do not copy the log every time;
+	// kept() hides the entries beyond capacity meanwhile
+	if len(l.changes) >= 2*l.capacity {
+		l.changes = append(l.changes[:0:0], l.kept()...)
+	}
+	return c.Seq, nil
+}
+
+// kept returns the most recent capacity changes
+func (l *MemoryChangeLog) kept() []Change {
+	if len(l.changes) > l.capacity {
+		return l.changes[len(l.changes)-l.capacity:]
+	}
+	return l.changes
+}
+
+// Since returns the changes recorded after seq, or a *CursorExpiredError
+// when some of them were discarded
+func (l *MemoryChangeLog) Since(seq uint64, limit int) ([]Change, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kept := l.kept()
+	if len(kept) > 0 && seq+1 < kept[0].Seq {
+		return nil, &CursorExpiredError{Oldest: kept[0].Seq}
+	}
+	var out []Change
+	for _, c := range kept {
+		if c.Seq <= seq {
+			continue
+		}
+		out = append(out, c)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+// SetChangeLog enables the change feed: every successful create, update and
+// delete is appended to log and delivered to SubscribeChanges listeners.
+// On the server, RegisterRoutes also exposes GET /changes.
+func (cp *CrudP) SetChangeLog(log ChangeLog) {
+	cp.changeLog = log
+}
+
+// SetUserID configures the current user's id extractor (same data as SetUserRoles).
+// Used as Actor in the change feed.
+func (cp *CrudP) SetUserID(fn func(data ...any) string) {
+	cp.getUserID = fn
+}
+
+// SubscribeChanges registers fn to receive every recorded change, in order,
+// right after it is appended. Changes are delivered one at a time: fn must
+// not mutate through CallHandler itself (start a goroutine instead). It
+// returns a function that removes the listener.
+func (cp *CrudP) SubscribeChanges(fn func(Change)) (unsubscribe func()) {
+	cp.feedMu.Lock()
+	defer cp.feedMu.Unlock()
+
+	if cp.feedListeners == nil {
+		cp.feedListeners = make(map[int]func(Change))
+	}
+	cp.feedNextID++
+	id := cp.feedNextID
+	cp.feedListeners[id] = fn
+
+	return func() {
+		cp.feedMu.Lock()
+		delete(cp.feedListeners, id)
+		cp.feedMu.Unlock()
+	}
+}
+
+// recordChange appends a successful mutation to the change feed.
+// id is the resolved entity id and encoded the entity (nil for deletes).
+func (cp *CrudP) recordChange(handler actionHandler, action byte, id string, encoded []byte, data ...any) {
+	if cp.changeLog == nil {
+		return
+	}
+
+	c := Change{
+		Handler: handler.name,
+		Action:  action,
+		ID:      id,
+		Data:    encoded,
+		Time:    time.Now().UnixMilli(),
+	}
+	if cp.getUserID != nil {
+		c.Actor = cp.getUserID(data...)
+	}
+	c.Tenant = cp.changeTenant(handler, data...)
+
+	seq, err := cp.changeLog.Append(c)
+	if err != nil {
+		cp.log("change feed append failed:", err)
+		return
+	}
+	c.Seq = seq
+
+	cp.feedMu.Lock()
+	listeners := make([]func(Change), 0, len(cp.feedListeners))
+	for _, fn := range cp.feedListeners {
+		listeners = append(listeners, fn)
+	}
+	cp.feedMu.Unlock()
+
+	for _, fn := range listeners {
+		fn(c)
+	}
+}
+
+// mutationData encodes the entity affected by a create or update: the
+// handler result, or the payload when the handler returned nothing.
+// Deletes and results that are not a single item yield nil.
+func (cp *CrudP) mutationData(action byte, payload, result any) []byte {
+	if action == 'd' {
+		return nil
+	}
+	entity := result
+	if entity == nil {
+		entity = payload
+	}
+	var pr PacketResult
+	if err := cp.encodeResult(&pr, entity, cp.defaultCodec()); err != nil || len(pr.Data) != 1 {
+		return nil
+	}
+	return pr.Data[0]
+}
+
+// entityID resolves the id of a mutated entity: the explicit id, or the id
+// of the result or payload (see idOf)
+func entityID(id string, payload, result any) string {
+	if id != "" {
+		return id
+	}
+	if id = idOf(result); id != "" {
+		return id
+	}
+	return idOf(payload)
+}
+
+// idOf returns the EntityID of a Versioned entity, or the string ID field
+// of a struct entity. Empty when the entity carries no id.
+func idOf(entity any) string {
+	if v, ok := entity.(Versioned); ok {
+		return v.EntityID()
+	}
+	rv := reflect.ValueOf(entity)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return ""
+	}
+	if f := rv.FieldByName("ID"); f.IsValid() && f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
+
+// changesFor returns the changes after since that the caller may read,
+// checking 'r' access once per handler and RecordAccess per change. With
+// multi-tenancy, only changes of the caller's tenant are returned.
+func (cp *CrudP) changesFor(since uint64, limit int, data ...any) (*ChangeFeed, error) {
+	if cp.changeLog == nil {
+		return nil, Errf("change feed not configured")
+	}
+
+	changes, err := cp.changeLog.Since(since, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	type reader struct {
+		allowed bool
+		policy  *callPolicy
+	}
+	feed := &ChangeFeed{Changes: make([]Change, 0, len(changes)), Cursor: since}
+	readers := make(map[string]reader)
+	tenant := cp.tenantOf(data...)
+	if err := cp.authorizeTenant(tenant, data...); err != nil {
+		return nil, err
+	}
+	for _, c := range changes {
+		feed.Cursor = c.Seq
+		if c.Tenant != "" && c.Tenant != tenant {
+			continue
+		}
+
+		r, checked := readers[c.Handler]
+		if !checked {
+			for _, h := range cp.handlers {
+				if h.name == c.Handler {
+					r.allowed = cp.accessCheck(h, 'r', data...) == nil
+					r.policy = cp.policyFor(h, tenant, data...)
+					break
+				}
+			}
+			readers[c.Handler] = r
+		}
+		if !r.allowed {
+			continue
+		}
+		if out, ok := r.policy.change(c.Action, c.ID, c.Data); ok {
+			c.Data = out
+			feed.Changes = append(feed.Changes, c)
+		}
+	}
+	return feed, nil
+}
@@ -0,0 +1,241 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/crudp"
+)
+
+func TestChangeFeed(t *testing.T) {
+	docStore = map[string]*Doc{"1": {ID: "1", Rev: 1, Txt: "a"}, "2": {ID: "2", Rev: 1}}
+
+	cp := NewTestCrudP()
+	cp.SetChangeLog(crudp.NewMemoryChangeLog(0))
+	cp.SetUserID(func(data ...any) string { return "alice" })
+	if err := cp.RegisterHandlers(&Doc{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	cp.RegisterRoutes(mux)
+
+	var received []crudp.Change
+	unsubscribe := cp.SubscribeChanges(func(c crudp.Change) { received = append(received, c) })
+
+	var data []byte
+	jsonEncode(&Doc{ID: "1", Rev: 1, Txt: "b"}, &data)
+	cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'u', ReqID: "u1", Data: [][]byte{data}}}})
+	cp.CallHandler(0, 'd', "2")
+	cp.CallHandler(0, 'r', "1") // reads are not recorded
+
+	if len(received) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(received))
+	}
+	if c := received[0]; c.Seq != 1 || c.Action != 'u' || c.ID != "1" || c.Actor != "alice" || len(c.Data) == 0 {
+		t.Errorf("unexpected update change: %+v", c)
+	}
+	// Listeners get the deleted entity; GET /changes omits it
+	if c := received[1]; c.Seq != 2 || c.Action != 'd' || c.ID != "2" || !strings.Contains(string(c.Data), `"id":"2"`) {
+		t.Errorf("unexpected delete change: %+v", c)
+	}
+
+	unsubscribe()
+	cp.CallHandler(0, 'd', "1")
+	if len(received) != 2 {
+		t.Error("listener called after unsubscribe")
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/changes?since=1&limit=10", nil))
+	var feed crudp.ChangeFeed
+	if err := jsonDecode(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("failed to decode feed: %v", err)
+	}
+	if len(feed.Changes) != 2 || feed.Changes[0].Seq != 2 || feed.Changes[0].Data != nil || feed.Cursor != 3 {
+		t.Errorf("unexpected feed: %+v", feed)
+	}
+}
+
+func TestDeltaSync(t *testing.T) {
+	docStore = map[string]*Doc{"1": {ID: "1", Rev: 1}, "2": {ID: "2", Rev: 1}}
+
+	cp := NewTestCrudP()
+	cp.SetChangeLog(crudp.NewMemoryChangeLog(0))
+	if err := cp.RegisterHandlers(&Doc{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+
+	mutate := func(action byte, doc *Doc, id string) {
+		var data [][]byte
+		if doc != nil {
+			var b []byte
+			jsonEncode(doc, &b)
+			data = [][]byte{b}
+		} else {
+			data = [][]byte{[]byte(id)}
+		}
+		resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: action, Data: data}}})
+		if resp.Results[0].MessageType != 4 {
+			t.Fatalf("mutation %c failed: %s", action, resp.Results[0].Message)
+		}
+	}
+
+	mutate('u', &Doc{ID: "1", Rev: 1, Txt: "edited"}, "")
+	mutate('c', &Doc{ID: "3"}, "")
+	mutate('d', nil, "2")
+	mutate('c', &Doc{ID: "4"}, "")
+	mutate('d', nil, "4")
+
+	resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 's', ReqID: "s1"}}})
+	got := ""
+	for _, res := range resp.Results {
+		got += string(res.Action)
+	}
+	if got != "ucds" {
+		t.Fatalf("expected results 'ucds', got %q", got)
+	}
+	if tomb := resp.Results[2]; string(tomb.Data[0]) != "2" {
+		t.Errorf("expected tombstone for id 2, got %s", tomb.Data[0])
+	}
+	last := resp.Results[len(resp.Results)-1]
+	if last.Cursor != 5 || last.ReqID != "s1" {
+		t.Errorf("expected final cursor 5, got %d", last.Cursor)
+	}
+
+	resp, _ = cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 's', Cursor: last.Cursor}}})
+	if len(resp.Results) != 1 || resp.Results[0].Cursor != 5 {
+		t.Errorf("expected only the cursor result when up to date, got %d results", len(resp.Results))
+	}
+}
+
+func TestMemoryChangeLogCapacity(t *testing.T) {
+	log := crudp.NewMemoryChangeLog(3)
+	for i := 0; i < 10; i++ {
+		log.Append(crudp.Change{Handler: "docs", Action: 'u'})
+	}
+	changes, _ := log.Since(7, 0)
+	if len(changes) != 3 || changes[0].Seq != 8 || changes[2].Seq != 10 {
+		t.Errorf("expected the last 3 changes, got %+v", changes)
+	}
+	if changes, _ := log.Since(8, 1); len(changes) != 1 || changes[0].Seq != 9 {
+		t.Errorf("expected change 9, got %+v", changes)
+	}
+
+	// Changes 1 to 7 were discarded
+	_, err := log.Since(0, 0)
+	if expired, ok := err.(*crudp.CursorExpiredError); !ok || expired.Oldest != 8 {
+		t.Errorf("expected an expired cursor, got %v", err)
+	}
+}
+
+func TestSyncCursorExpired(t *testing.T) {
+	docStore = map[string]*Doc{"1": {ID: "1", Rev: 1}}
+
+	cp := NewTestCrudP()
+	cp.SetChangeLog(crudp.NewMemoryChangeLog(2))
+	if err := cp.RegisterHandlers(&Doc{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	cp.RegisterRoutes(mux)
+	for i := 0; i < 4; i++ {
+		cp.CallHandler(0, 'd', "1")
+	}
+
+	resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 's', Cursor: 1}}})
+	if len(resp.Results) != 1 {
+		t.Fatalf("expected a single result, got %d", len(resp.Results))
+	}
+	res := resp.Results[0]
+	if res.Action != 's' || res.Status != 410 || res.Cursor != 4 {
+		t.Errorf("expected 410 with the latest cursor, got status %d cursor %d", res.Status, res.Cursor)
+	}
+
+	if resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 's', Cursor: 2}}}); resp.Results[0].Status != 0 {
+		t.Errorf("expected a cursor still in the log to sync, got %d", resp.Results[0].Status)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/changes?since=1", nil))
+	if rec.Code != http.StatusGone {
+		t.Errorf("expected 410 from the change feed, got %d", rec.Code)
+	}
+}
+
+func TestDeletePacketSingleID(t *testing.T) {
+	docStore = map[string]*Doc{"1": {ID: "1", Rev: 1}, "2": {ID: "2", Rev: 1}}
+
+	cp := NewTestCrudP()
+	if err := cp.RegisterHandlers(&Doc{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+
+	resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'd', ReqID: "d1", Data: [][]byte{[]byte("1"), []byte("2")}}}})
+	if res := resp.Results[0]; res.Status != 400 {
+		t.Errorf("expected 400 for a delete with two ids, got %+v", res)
+	}
+	if len(docStore) != 2 {
+		t.Errorf("a rejected delete must not remove any doc, got %+v", docStore)
+	}
+
+	resp, _ = cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'd', ReqID: "d2", Data: [][]byte{[]byte("2")}}}})
+	if res := resp.Results[0]; res.Message != "OK" {
+		t.Errorf("expected the single-id delete to succeed, got %+v", res)
+	}
+	if _, ok := docStore["2"]; ok || len(docStore) != 1 {
+		t.Errorf("expected only doc 2 deleted, got %+v", docStore)
+	}
+}
+
+func TestChangesDeliveredInOrder(t *testing.T) {
+	ledgerStore = map[string]Ledger{}
+	for i := 1; i <= 20; i++ {
+		ledgerStore[strconv.Itoa(i)] = Ledger{ID: strconv.Itoa(i), Rev: 1}
+	}
+	cp := NewTestCrudP()
+	cp.SetChangeLog(crudp.NewMemoryChangeLog(0))
+	pusher := &fakePusher{pushed: map[string][]crudp.PacketResult{}}
+	cp.SetPusher(pusher, crudp.NewSSEPusher(cp).ConnID)
+	if err := cp.RegisterHandlers(&Ledger{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: '+', ReqID: "s1"}}}, connRequest("c1"))
+
+	var received []crudp.Change
+	cp.SubscribeChanges(func(c crudp.Change) {
+		// A slow listener must not let later changes overtake this one
+		if c.Seq%2 == 1 {
+			time.Sleep(time.Millisecond)
+		}
+		received = append(received, c)
+	})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			cp.CallHandler(0, 'u', &Ledger{ID: id, Rev: 1})
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	pushed := pusher.pushed["c1"]
+	if len(received) != 20 || len(pushed) != 20 {
+		t.Fatalf("expected 20 changes and pushes, got %d and %d", len(received), len(pushed))
+	}
+	for i, c := range received {
+		var l Ledger
+		jsonDecode(pushed[i].Data[0], &l)
+		if c.Seq != uint64(i+1) || l.ID != c.ID {
+			t.Fatalf("change %d: expected seq %d pushed as %s, got seq %d pushed as %s", i, i+1, c.ID, c.Seq, l.ID)
+		}
+	}
+}
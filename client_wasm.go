@@ -3,6 +3,8 @@
 package crudp
 
 import (
+	"time"
+
 	"github.com/tinywasm/fetch"
 )
 
@@ -11,16 +13,117 @@ import (
 func (cp *CrudP) InitClient() {
 	fetch.SetHandler(func(resp *fetch.Response) {
 		var batchResp BatchResponse
-		if cp.decode == nil {
-			cp.log("decode function not configured")
+		if err := cp.decodeResponse(resp, &batchResp); err != nil {
+			cp.log("error decoding batch response:", err)
 			return
 		}
 
-		if err := cp.decode(resp.Body(), &batchResp); err != nil {
-			cp.log("error decoding batch response:", err)
+		cp.HandleResponse(&batchResp)
+	})
+}
+
+// Send posts a BatchRequest to the server's /batch endpoint and routes the
+// response into HandleResponse. Transient failures are retried following
+// the configured RetryPolicy; creates without an IdempotencyKey are dropped
+// from retries. The CSRF token cookie, when present, is sent in CSRFHeader.
+// Cached reads are answered locally and, in optimistic mode, mutations are
+// applied locally first.
+func (cp *CrudP) Send(req *BatchRequest) {
+	if req == nil {
+		return
+	}
+	req = cp.serveCachedReads(req)
+	if len(req.Packets) == 0 {
+		return
+	}
+	cp.applyOptimistic(req)
+	cp.sendAttempt(req, 1)
+}
+
+func (cp *CrudP) sendAttempt(req *BatchRequest, attempt int) {
+	codec := cp.defaultCodec()
+	body, err := encodeEnvelope(codec, cp.binaryEnvelope, req)
+	if err != nil {
+		cp.log("error encoding batch request:", err)
+		return
+	}
+
+	// The default codec is the client's preferred one: entities are always
+	// encoded with it and the server is asked to answer with it
+	mime := codec.MIME
+	if cp.binaryEnvelope {
+		mime = MIMEBinary
+	}
+	request := fetch.Post("batch").Header("Content-Type", mime).Header("Accept", mime).Body(body)
+	if connID := cp.pushConnID(); connID != "" {
+		request.Header(ConnHeader, connID)
+	}
+	if token := csrfToken(); token != "" {
+		request.Header(CSRFHeader, token)
+	}
+	request.Send(func(resp *fetch.Response, err error) {
+		status := 0
+		if resp != nil {
+			status = resp.Status
+		}
+
+		if err == nil && status < 400 {
+			var batchResp BatchResponse
+			if err := cp.decodeResponse(resp, &batchResp); err != nil {
+				cp.log("error decoding batch response:", err)
+				return
+			}
+			cp.HandleResponse(&batchResp)
 			return
 		}
 
-		cp.HandleResponse(&batchResp)
+		if !cp.retry.ShouldRetry(attempt, status, err) {
+			cp.failPackets(req.Packets, status, err)
+			return
+		}
+
+		safe, unsafe := splitRetrySafe(req.Packets)
+		if len(unsafe) > 0 {
+			cp.failPackets(unsafe, status, err)
+		}
+		if len(safe) == 0 {
+			return
+		}
+
+		delay := cp.retry.Delay(attempt)
+		cp.log("retrying batch in", delay, "ms, attempt", attempt+1)
+		time.AfterFunc(time.Duration(delay)*time.Millisecond, func() {
+			cp.sendAttempt(&BatchRequest{Packets: safe}, attempt+1)
+		})
 	})
 }
+
+// failPackets reports packets that could not be delivered to the server
+// and rolls back those applied optimistically.
+func (cp *CrudP) failPackets(packets []Packet, status int, err error) {
+	for _, p := range packets {
+		if sent, ok := cp.takePending(p.ReqID); ok {
+			cp.rollback(&sent, nil)
+		}
+		if err != nil {
+			cp.log("batch packet failed:", p.ReqID, err)
+		} else {
+			cp.log("batch packet failed:", p.ReqID, "status", status)
+		}
+	}
+}
+
+// decodeResponse decodes a batch response in the envelope named by its Content-Type
+func (cp *CrudP) decodeResponse(resp *fetch.Response, out *BatchResponse) error {
+	contentType := resp.GetHeader("Content-Type")
+	if IsBinaryContentType(contentType) {
+		return DecodeBinary(resp.Body(), out)
+	}
+	codec := cp.defaultCodec()
+	if types := mediaTypes(contentType); len(types) > 0 {
+		if c, ok := cp.codecByMIME(types[0]); ok {
+			codec = c
+		}
+	}
+	return decodeEnvelope(codec, false, resp.Body(), out)
+}
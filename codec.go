@@ -0,0 +1,222 @@
+package crudp
+
+import (
+	"reflect"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// MIMEJSON is the content type the SetCodecs pair is registered under
+const MIMEJSON = "application/json"
+
+// Codec is a serialization format identified by its MIME type. Encode and
+// Decode follow the SetCodecs signatures.
+type Codec struct {
+	MIME   string
+	Encode func(input any, output any) error
+	Decode func(input any, output any) error
+}
+
+// activeCodec is the codec negotiated for a request: in decodes the
+// request entities, out encodes the results. It travels in the injected
+// data next to the *http.Request.
+type activeCodec struct {
+	in  Codec
+	out Codec
+}
+
+// AddCodec registers an additional codec under mime. Registering a MIME type
+// again replaces its codec. The default codec is not changed.
+func (cp *CrudP) AddCodec(mime string, encode, decode func(input any, output any) error) {
+	c := Codec{MIME: mime, Encode: encode, Decode: decode}
+	for i := range cp.codecs {
+		if cp.codecs[i].MIME == mime {
+			cp.codecs[i] = c
+			cp.syncDefaultCodec()
+			return
+		}
+	}
+	cp.codecs = append(cp.codecs, c)
+	cp.syncDefaultCodec()
+}
+
+// SetDefaultCodec selects the registered codec used when a request carries
+// no Content-Type/Accept, for stored data (change feed, caches) and, on the
+// WASM client, for every batch it sends.
+func (cp *CrudP) SetDefaultCodec(mime string) error {
+	for i, c := range cp.codecs {
+		if c.MIME == mime {
+			copy(cp.codecs[1:i+1], cp.codecs[:i])
+			cp.codecs[0] = c
+			cp.syncDefaultCodec()
+			return nil
+		}
+	}
+	return errorf("codec not registered: %s", mime)
+}
+
+// Codecs returns the registered MIME types, the default first
+func (cp *CrudP) Codecs() []string {
+	mimes := make([]string, len(cp.codecs))
+	for i, c := range cp.codecs {
+		mimes[i] = c.MIME
+	}
+	return mimes
+}
+
+// syncDefaultCodec mirrors the default codec into encode/decode
+func (cp *CrudP) syncDefaultCodec() {
+	if len(cp.codecs) == 0 {
+		return
+	}
+	cp.encode = cp.codecs[0].Encode
+	cp.decode = cp.codecs[0].Decode
+}
+
+// defaultCodec returns the default codec (zero Codec when none is configured)
+func (cp *CrudP) defaultCodec() Codec {
+	if len(cp.codecs) == 0 {
+		return Codec{MIME: MIMEJSON, Encode: cp.encode, Decode: cp.decode}
+	}
+	return cp.codecs[0]
+}
+
+// codecByMIME returns the codec registered under a MIME type
+func (cp *CrudP) codecByMIME(mime string) (Codec, bool) {
+	for _, c := range cp.codecs {
+		if c.MIME == mime {
+			return c, true
+		}
+	}
+	if len(cp.codecs) == 0 && mime == MIMEJSON {
+		// Nothing configured yet: fail later with "not configured" errors
+		return cp.defaultCodec(), true
+	}
+	return Codec{}, false
+}
+
+// transcode re-encodes an entity stored with the default codec (change
+// feed data) into codec c
+func (cp *CrudP) transcode(handler actionHandler, data []byte, c Codec) ([]byte, error) {
+	def := cp.defaultCodec()
+	if c.MIME == def.MIME || handler.dataType == nil || data == nil {
+		return data, nil
+	}
+	if c.Encode == nil {
+		return nil, Errf("codec not configured")
+	}
+
+	entity, err := cp.decodeEntity(handler, data)
+	if err != nil {
+		return nil, err
+	}
+	var encoded []byte
+	if err := c.Encode(entity, &encoded); err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
+
+// decodeEntity decodes data encoded with the default codec into a new
+// entity of the handler's type
+func (cp *CrudP) decodeEntity(handler actionHandler, data []byte) (any, error) {
+	def := cp.defaultCodec()
+	if def.Decode == nil || handler.dataType == nil {
+		return nil, Errf("codec not configured")
+	}
+	entity := reflect.New(handler.dataType).Interface()
+	if err := def.Decode(data, entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// codecFrom returns the codec injected in data, the default one otherwise
+func (cp *CrudP) codecFrom(data []any) activeCodec {
+	for _, d := range data {
+		if c, ok := d.(activeCodec); ok {
+			return c
+		}
+	}
+	def := cp.defaultCodec()
+	return activeCodec{in: def, out: def}
+}
+
+// mediaTypes splits a Content-Type/Accept value into bare MIME types,
+// dropping parameters and entries with q=0
+func mediaTypes(value string) []string {
+	var types []string
+	for _, part := range Split(value, ",") {
+		params := Split(part, ";")
+		mime := Convert(params[0]).TrimSpace().String()
+		if mime == "" {
+			continue
+		}
+		rejected := false
+		for _, p := range params[1:] {
+			p = Convert(p).TrimSpace().String()
+			if p == "q=0" || p == "q=0.0" || p == "q=0.00" || p == "q=0.000" {
+				rejected = true
+			}
+		}
+		if !rejected {
+			types = append(types, mime)
+		}
+	}
+	return types
+}
+
+// negotiation is the outcome of matching Content-Type/Accept with the
+// registered codecs. Binary envelopes carry entities in the default codec.
+type negotiation struct {
+	codec     activeCodec
+	binaryIn  bool
+	binaryOut bool
+	status    uint16 // 415 or 406 on mismatch, 0 otherwise
+}
+
+// negotiate selects the request decoder from contentType and the response
+// encoder from accept. allowBinary enables the binary envelope (batches only).
+// An empty or wildcard Accept answers in the request's format.
+func (cp *CrudP) negotiate(contentType, accept string, allowBinary bool) negotiation {
+	var n negotiation
+	def := cp.defaultCodec()
+
+	n.codec.in = def
+	if types := mediaTypes(contentType); len(types) > 0 {
+		mime := types[0]
+		switch c, ok := cp.codecByMIME(mime); {
+		case ok:
+			n.codec.in = c
+		case allowBinary && mime == MIMEBinary:
+			n.binaryIn = true
+		default:
+			n.status = 415
+			return n
+		}
+	}
+
+	n.codec.out = n.codec.in
+	n.binaryOut = n.binaryIn
+	types := mediaTypes(accept)
+	if len(types) == 0 {
+		return n
+	}
+	for _, mime := range types {
+		if mime == "*/*" {
+			return n
+		}
+		if c, ok := cp.codecByMIME(mime); ok {
+			n.codec.out = c
+			n.binaryOut = false
+			return n
+		}
+		if allowBinary && mime == MIMEBinary {
+			n.codec.out = def
+			n.binaryOut = true
+			return n
+		}
+	}
+	n.status = 406
+	return n
+}
@@ -0,0 +1,118 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+const mimeGob = "application/x-gob"
+
+func gobEncode(input any, output any) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(input); err != nil {
+		return err
+	}
+	*(output.(*[]byte)) = buf.Bytes()
+	return nil
+}
+
+func gobDecode(input any, output any) error {
+	return gob.NewDecoder(bytes.NewReader(input.([]byte))).Decode(output)
+}
+
+func TestContentNegotiation(t *testing.T) {
+	newServer := func(t *testing.T) *http.ServeMux {
+		cp, mux := newDocServer(t)
+		cp.AddCodec(mimeGob, gobEncode, gobDecode)
+		return mux
+	}
+
+	t.Run("Batch In Request Codec", func(t *testing.T) {
+		mux := newServer(t)
+
+		var doc, body []byte
+		gobEncode(&Doc{ID: "1", Rev: 3, Txt: "gob"}, &doc)
+		gobEncode(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'u', ReqID: "u1", Data: [][]byte{doc}}}}, &body)
+
+		req := httptest.NewRequest("POST", "/batch", httpBodyFromBytes(body))
+		req.Header.Set("Content-Type", mimeGob)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if ct := rec.Header().Get("Content-Type"); ct != mimeGob {
+			t.Fatalf("expected %s response, got %q: %s", mimeGob, ct, rec.Body.String())
+		}
+		var resp crudp.BatchResponse
+		if err := gobDecode(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		var updated Doc
+		if err := gobDecode(resp.Results[0].Data[0], &updated); err != nil || updated.Rev != 4 || updated.Txt != "gob" {
+			t.Errorf("expected gob encoded entity at rev 4, got %+v (%v)", updated, err)
+		}
+	})
+
+	t.Run("Accept Selects Encoder", func(t *testing.T) {
+		mux := newServer(t)
+
+		req := httptest.NewRequest("GET", "/docs/1", nil)
+		req.Header.Set("Accept", "text/html, "+mimeGob+";q=0.9")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		var resp crudp.Response
+		if err := gobDecode(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("expected gob response: %v (%s)", err, rec.Header().Get("Content-Type"))
+		}
+		var doc Doc
+		if err := gobDecode(resp.Data[0], &doc); err != nil || doc.Txt != "hello" {
+			t.Errorf("unexpected entity %+v (%v)", doc, err)
+		}
+	})
+
+	t.Run("Unsupported Media Type", func(t *testing.T) {
+		mux := newServer(t)
+
+		req := httptest.NewRequest("POST", "/batch", httpBodyFromBytes([]byte("x")))
+		req.Header.Set("Content-Type", "text/plain")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected 415, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Not Acceptable", func(t *testing.T) {
+		mux := newServer(t)
+
+		req := httptest.NewRequest("GET", "/docs/1", nil)
+		req.Header.Set("Accept", "application/xml, "+mimeGob+";q=0")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotAcceptable {
+			t.Errorf("expected 406, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Default Codec", func(t *testing.T) {
+		cp := crudp.New()
+		cp.SetCodecs(jsonEncode, jsonDecode)
+		cp.AddCodec(mimeGob, gobEncode, gobDecode)
+		if err := cp.SetDefaultCodec(mimeGob); err != nil {
+			t.Fatal(err)
+		}
+		if got := cp.Codecs(); len(got) != 2 || got[0] != mimeGob || got[1] != crudp.MIMEJSON {
+			t.Errorf("unexpected codec order: %v", got)
+		}
+		if err := cp.SetDefaultCodec("application/xml"); err == nil || err.Error() != "codec not registered: application/xml" {
+			t.Errorf("expected error naming the unregistered codec, got %v", err)
+		}
+	})
+}
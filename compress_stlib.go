@@ -0,0 +1,127 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// readBody reads a request body up to Limits.MaxBodyBytes (413 beyond it).
+// With compression enabled, gzip and deflate bodies (Content-Encoding) are
+// decompressed, the limit applying to the decompressed size, and other
+// encodings fail with 415.
+func (cp *CrudP) readBody(r *http.Request) ([]byte, error) {
+	max := cp.limits.MaxBodyBytes
+	if max > 0 && r.ContentLength > max {
+		return nil, bodyTooLarge(max)
+	}
+
+	var reader io.Reader = r.Body
+	if cp.compression != nil {
+		switch encoding := r.Header.Get("Content-Encoding"); encoding {
+		case "", "identity":
+		case "gzip":
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				return nil, &StatusError{Code: 400, Message: "invalid gzip body"}
+			}
+			defer gz.Close()
+			reader = gz
+		case "deflate":
+			zr, err := zlib.NewReader(r.Body)
+			if err != nil {
+				return nil, &StatusError{Code: 400, Message: "invalid deflate body"}
+			}
+			defer zr.Close()
+			reader = zr
+		default:
+			return nil, &StatusError{Code: 415, Message: "unsupported content encoding: " + encoding}
+		}
+	}
+
+	if max > 0 {
+		reader = io.LimitReader(reader, max+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, &StatusError{Code: 400, Message: "Error reading body"}
+	}
+	if max > 0 && int64(len(body)) > max {
+		return nil, bodyTooLarge(max)
+	}
+	return body, nil
+}
+
+func bodyTooLarge(max int64) error {
+	return &StatusError{Code: 413, Message: Sprintf("request body exceeds %d bytes", max)}
+}
+
+// writeBody writes an encoded response, compressing it when compression is
+// enabled, the body reaches MinSize and the client accepts gzip or deflate.
+// status 0 means 200.
+func (cp *CrudP) writeBody(w http.ResponseWriter, r *http.Request, status int, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+
+	if cp.compression != nil {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if encoding := acceptedEncoding(r.Header.Get("Accept-Encoding")); encoding != "" && len(body) >= cp.compression.minSize() {
+			if compressed, err := compress(encoding, cp.compression.Level, body); err == nil {
+				w.Header().Set("Content-Encoding", encoding)
+				body = compressed
+			} else {
+				cp.log("response compression failed:", err)
+			}
+		}
+	}
+
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+	w.Write(body)
+}
+
+// acceptedEncoding picks gzip or deflate from an Accept-Encoding value,
+// in the client's order
+func acceptedEncoding(accept string) string {
+	for _, encoding := range mediaTypes(accept) {
+		switch encoding {
+		case "gzip", "deflate":
+			return encoding
+		case "*":
+			return "gzip"
+		}
+	}
+	return ""
+}
+
+func compress(encoding string, level int, body []byte) ([]byte, error) {
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	if encoding == "gzip" {
+		w, err = gzip.NewWriterLevel(&buf, level)
+	} else {
+		w, err = zlib.NewWriterLevel(&buf, level)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
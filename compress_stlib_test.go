@@ -0,0 +1,99 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+func TestCompression(t *testing.T) {
+	createBatch := func() []byte {
+		var doc, body []byte
+		jsonEncode(&Doc{ID: "2", Txt: "new"}, &doc)
+		jsonEncode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', ReqID: "c1", Data: [][]byte{doc}}}}, &body)
+		return body
+	}
+
+	t.Run("Compressed Response", func(t *testing.T) {
+		cp, mux := newDocServer(t)
+		cp.SetCompression(&crudp.Compression{MinSize: 10})
+
+		for _, encoding := range []string{"gzip", "deflate"} {
+			req := httptest.NewRequest("GET", "/docs/1", nil)
+			req.Header.Set("Accept-Encoding", encoding+", br")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != encoding {
+				t.Fatalf("expected Content-Encoding %s, got %q", encoding, got)
+			}
+			var reader io.Reader
+			if encoding == "gzip" {
+				reader, _ = gzip.NewReader(rec.Body)
+			} else {
+				reader, _ = zlib.NewReader(rec.Body)
+			}
+			plain, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("failed to decompress %s body: %v", encoding, err)
+			}
+			var resp crudp.Response
+			if err := jsonDecode(plain, &resp); err != nil || len(resp.Data) != 1 {
+				t.Errorf("unexpected %s response %s (%v)", encoding, plain, err)
+			}
+		}
+	})
+
+	t.Run("Below Threshold", func(t *testing.T) {
+		cp, mux := newDocServer(t)
+		cp.SetCompression(&crudp.Compression{MinSize: 1 << 20})
+
+		req := httptest.NewRequest("POST", "/batch", httpBodyFromBytes(createBatch()))
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Header().Get("Content-Encoding") != "" {
+			t.Error("small response must not be compressed")
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("expected Vary: Accept-Encoding, got %q", rec.Header().Get("Vary"))
+		}
+	})
+
+	t.Run("Compressed Request", func(t *testing.T) {
+		cp, mux := newDocServer(t)
+		cp.SetCompression(&crudp.Compression{})
+
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(createBatch())
+		gz.Close()
+
+		req := httptest.NewRequest("POST", "/batch", httpBodyFromBytes(buf.Bytes()))
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		var resp crudp.BatchResponse
+		if err := jsonDecode(rec.Body.Bytes(), &resp); err != nil || len(resp.Results) != 1 || resp.Results[0].MessageType != 4 {
+			t.Fatalf("unexpected response %s (%v)", rec.Body.String(), err)
+		}
+
+		req = httptest.NewRequest("POST", "/batch", httpBodyFromBytes(buf.Bytes()))
+		req.Header.Set("Content-Encoding", "br")
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected 415 for unsupported encoding, got %d", rec.Code)
+		}
+	})
+}
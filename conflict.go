@@ -0,0 +1,207 @@
+package crudp
+
+import (
+	"reflect"
+	"sync"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// ConflictError reports a write based on a stale version of an entity.
+// Current is the stored copy; results carry it encoded in Data so the
+// client can merge. Code is 409 for version conflicts and 412 for failed
+// If-Match preconditions.
+type ConflictError struct {
+	Code    uint16
+	Current any
+}
+
+func (e *ConflictError) Error() string {
+	if e.Code == 412 {
+		return "precondition failed: entity was modified"
+	}
+	return "conflict: entity was modified by another client"
+}
+
+// StatusCode returns the HTTP-like status code of the conflict
+func (e *ConflictError) StatusCode() uint16 { return e.Code }
+
+// checkVersion compares the version of an incoming entity with the stored
+// copy and fails with a ConflictError when they differ. Entities sent
+// without a version are not checked. CallHandler holds writeLocks for the
+// entity across the check and the write.
+func (cp *CrudP) checkVersion(stored *storedEntity, incoming Versioned) error {
+	if incoming.Version() == "" || incoming.EntityID() == "" || stored.read == nil {
+		return nil
+	}
+
+	current, err := stored.load()
+	if err != nil || current == nil {
+		return err
+	}
+
+	if v, ok := current.(Versioned); ok && v.Version() != incoming.Version() {
+		return &ConflictError{Code: 409, Current: current}
+	}
+	return nil
+}
+
+// versionChecked reports whether an update or delete carries a version to
+// check: an If-Match value or a Versioned payload with a version
+func versionChecked(payload any, data []any) bool {
+	if v, ok := payload.(Versioned); ok && v.Version() != "" {
+		return true
+	}
+	for _, d := range data {
+		if _, ok := d.(ifMatch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// entityLocks serializes the version check and the write of each entity, so
+// two writers holding the same version cannot both pass the check. The locks
+// only cover this process.
+type entityLocks struct {
+	mu    sync.Mutex
+	locks map[string]*entityLock
+}
+
+type entityLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock waits for the entity key and returns the function releasing it
+func (l *entityLocks) lock(key string) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*entityLock)
+	}
+	el, ok := l.locks[key]
+	if !ok {
+		el = &entityLock{}
+		l.locks[key] = el
+	}
+	el.refs++
+	l.mu.Unlock()
+
+	el.Lock()
+	return func() {
+		el.Unlock()
+		l.mu.Lock()
+		if el.refs--; el.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// setError fills an error result, keeping the status code carried by err.
+// Conflicts also carry the server copy, encoded with c, and its tag.
+func (cp *CrudP) setError(pr *PacketResult, err error, c Codec) {
+	pr.MessageType = uint8(Msg.Error)
+	pr.Message = err.Error()
+	pr.Status = statusOf(err)
+
+	if conflict, ok := err.(*ConflictError); ok && conflict.Current != nil {
+		pr.Data = nil
+		if encErr := cp.encodeResult(pr, conflict.Current, c); encErr == nil {
+			pr.Version = tagOf(conflict.Current, pr.Data)
+		}
+	}
+}
+
+// Conflict resolution outcomes reported in PacketResult.Resolution
+const (
+	ResolutionServerWins = "server-wins"
+	ResolutionClientWins = "client-wins"
+	ResolutionMerged     = "merged"
+)
+
+// ConflictResolver decides what to write when a versioned update conflicts
+// with the stored copy. It returns the entity to pass to Update (nil keeps
+// the server copy untouched) and an outcome reported in PacketResult.Resolution.
+// Returning an error rejects the update with that error.
+type ConflictResolver func(server, client any) (resolved any, outcome string, err error)
+
+// ServerWins keeps the stored copy and discards the client changes.
+func ServerWins() ConflictResolver {
+	return func(server, client any) (any, string, error) {
+		return nil, ResolutionServerWins, nil
+	}
+}
+
+// ClientWins writes the client copy over the stored one.
+func ClientWins() ConflictResolver {
+	return func(server, client any) (any, string, error) {
+		return client, ResolutionClientWins, nil
+	}
+}
+
+// LastWriterWins keeps the copy with the most recent Timestamped.UpdatedAt.
+// Ties favour the client. Entities that are not Timestamped keep the server copy.
+func LastWriterWins() ConflictResolver {
+	return func(server, client any) (any, string, error) {
+		s, sok := server.(Timestamped)
+		c, cok := client.(Timestamped)
+		if sok && cok && c.UpdatedAt() >= s.UpdatedAt() {
+			return client, ResolutionClientWins, nil
+		}
+		return nil, ResolutionServerWins, nil
+	}
+}
+
+// FieldMerge starts from the stored copy and applies every non-zero field of
+// the client copy. Both must be pointers to the same struct type.
+func FieldMerge() ConflictResolver {
+	return func(server, client any) (any, string, error) {
+		sv := reflect.ValueOf(server)
+		cv := reflect.ValueOf(client)
+		if sv.Kind() != reflect.Ptr || cv.Type() != sv.Type() || sv.Elem().Kind() != reflect.Struct {
+			return nil, "", Errf("field merge requires pointers to the same struct type")
+		}
+
+		merged := reflect.New(sv.Elem().Type())
+		merged.Elem().Set(sv.Elem())
+		for i := 0; i < cv.Elem().NumField(); i++ {
+			field := cv.Elem().Field(i)
+			if merged.Elem().Field(i).CanSet() && !field.IsZero() {
+				merged.Elem().Field(i).Set(field)
+			}
+		}
+		return merged.Interface(), ResolutionMerged, nil
+	}
+}
+
+// SetConflictResolver configures how version conflicts on updates of a handler
+// are resolved. Without a resolver, conflicts are returned as ConflictError.
+func (cp *CrudP) SetConflictResolver(handlerName string, resolver ConflictResolver) {
+	if cp.resolvers == nil {
+		cp.resolvers = make(map[string]ConflictResolver)
+	}
+	cp.resolvers[handlerName] = resolver
+}
+
+// resolution receives the outcome of a resolved conflict.
+// It travels in CallHandler data next to the injected request values.
+type resolution struct {
+	outcome string
+}
+
+// resolveConflict applies the handler's resolver to a conflicting update.
+// keep is true when the stored copy must be kept (server wins); otherwise
+// resolved is the payload to write.
+func (cp *CrudP) resolveConflict(handler actionHandler, client any, conflict *ConflictError) (resolved any, outcome string, keep bool, err error) {
+	resolver := cp.resolvers[handler.name]
+	if resolver == nil {
+		return nil, "", false, conflict
+	}
+
+	resolved, outcome, err = resolver(conflict.Current, client)
+	if err != nil {
+		return nil, "", false, err
+	}
+	return resolved, outcome, resolved == nil, nil
+}
@@ -2,6 +2,7 @@ package crudp
 
 import (
 	"reflect"
+	"sync"
 )
 
 type actionHandler struct {
@@ -9,13 +10,21 @@ type actionHandler struct {
 	index        uint8
 	handler      any
 	dataType     reflect.Type
+	cacheReads   bool
 	Create       func(payload any) (any, error)
 	Read         func(id string) (any, error)
 	List         func() (any, error)
+	StreamList   func(yield func(item any) bool) error
 	Update       func(payload any) (any, error)
 	Delete       func(id string) error
 	ValidateData func(action byte, payload any) error
 	AllowedRoles func(action byte) []byte
+	Rollback     func(action byte, payload any) error
+	AllowRecord  func(action byte, userID string, roles []byte, id string, record any) bool
+	fields       []fieldPolicy // Field policies from crudp struct tags
+	forTenant    func(tenant string) any
+	tenantScoped bool // TenantHandler or TenantOwned: requires a tenant when a resolver is set
+	tenantOwned  bool // TenantOwned: updates and deletes must load the stored entity
 }
 
 // AccessDeniedHandler defines the callback for failed access attempts
@@ -25,13 +34,52 @@ type AccessDeniedHandler func(handler string, action byte, userRoles []byte, all
 type CrudP struct {
 	encode              func(input any, output any) error
 	decode              func(input any, output any) error
+	codecs              []Codec // Registered codecs, the default (encode/decode) first
 	handlers            []actionHandler
 	log                 func(...any) // Never nil - uses no-op by default
 	devMode             bool
 	getUserRoles        func(data ...any) []byte
+	roleHierarchy       map[byte][]byte // Implied roles by role, expanded at check time
 	accessCheckFn       func(resource string, action byte, data ...any) bool
 	accessDeniedHandler AccessDeniedHandler
+	policies            *accessPolicies // Policy chain, replaces the default access check when set
+	explainRoles        []byte          // Roles allowed on the explain endpoints, nil when disabled
 	accessCheck         func(handler actionHandler, action byte, data ...any) error
+	policyChecks        bool       // RecordAccess and field policies, enabled by RegisterRoutes
+	recordNotFound      bool       // Denied records are reported as 404 instead of 403
+	cache               CacheStore // Server-side read-through cache for Cacheable handlers
+	compression         *Compression
+	limits              Limits
+	rateLimiter         *rateLimiter // Token buckets, nil when no rate limit is set
+	getRateKey          func(data ...any) string
+	getUserID           func(data ...any) string
+	getTenant           func(data ...any) string
+	tenantMember        func(userID, tenant string) bool     // Checks the caller belongs to the resolved tenant
+	authenticate        func(data ...any) (*Identity, error) // Set by SetAuthenticator (server only)
+	csrf                *CSRF                                // CSRF protection, nil when disabled
+	auditSink           AuditSink
+	changeLog           ChangeLog // Change feed store, nil when disabled
+	feedMu              sync.Mutex
+	changeMu            sync.Mutex // Held from the change log append to the last push, so changes are delivered in order
+	feedListeners       map[int]func(Change)
+	feedNextID          int
+	resolvers           map[string]ConflictResolver // Conflict resolvers by handler name
+	writeLocks          entityLocks                 // Serialize version checks and writes per entity
+	idempotent          idempotency                 // Results of creates by IdempotencyKey
+	pusher              Pusher
+	getConnID           func(data ...any) string
+	subsMu              sync.Mutex
+	subs                map[string][]subscription // Live subscriptions by connection id
+	retry               RetryPolicy               // Client-side (WASM) retry policy for outgoing batches
+	optimistic          bool                      // Client-side (WASM) optimistic execution of mutations
+	binaryEnvelope      bool                      // Client-side (WASM) batches use the binary envelope
+	clientMu            sync.Mutex
+	pending             map[string]Packet // Optimistic packets awaiting server confirmation, by ReqID
+	readCache           *LRUCache         // Client-side (WASM) read cache, nil when disabled
+	readKeys            map[string]string // Cache keys of reads in flight, by ReqID
+	syncCursors         map[uint8]uint64  // Client-side (WASM) last change seen per handler
+	connID              string            // Client-side (WASM) push connection id, set by Connect
+	clientSubs          map[string]Packet // Client-side (WASM) subscribe packets, resent on reconnect
 }
 
 // noOpAccessCheck is a default no-op access validation
@@ -45,15 +93,17 @@ func New() *CrudP {
 		decode:      nil,
 		log:         func(...any) {}, // No-op logger by default
 		accessCheck: noOpAccessCheck, // No-op by default
+		retry:       DefaultRetryPolicy(),
 	}
 
 	return cp
 }
 
-// SetCodecs configures custom serialization functions
+// SetCodecs configures custom serialization functions. They are registered
+// as the default codec under MIMEJSON; see AddCodec for more formats.
 func (cp *CrudP) SetCodecs(encode, decode func(input any, output any) error) {
-	cp.encode = encode
-	cp.decode = decode
+	cp.AddCodec(MIMEJSON, encode, decode)
+	cp.SetDefaultCodec(MIMEJSON)
 }
 
 // SetLog configures a custom logging function
@@ -91,7 +141,57 @@ func (cp *CrudP) SetAccessDeniedHandler(fn AccessDeniedHandler) {
 // The function receives the handler's resource name, the action byte ('c','r','u','d'),
 // and the raw request data (same variadic as SetUserRoles closure).
 // Must be called before RegisterHandlers().
-// Mutually exclusive with SetUserRoles — use one or the other.
+// Takes precedence over SetUserRoles; use SetAccessPolicies to combine both.
 func (cp *CrudP) SetAccessCheck(fn func(resource string, action byte, data ...any) bool) {
 	cp.accessCheckFn = fn
 }
+
+// SetRetryPolicy configures how the WASM client retries batches that fail
+// with a transient error. Use RetryPolicy{} to disable retries.
+func (cp *CrudP) SetRetryPolicy(policy RetryPolicy) {
+	cp.retry = policy
+}
+
+// SetOptimistic enables optimistic mode on the WASM client: mutations are
+// applied to the local handlers as soon as they are sent, replaced by the
+// server copy when confirmed, and rolled back if the server rejects them
+// (see Rollbacker).
+func (cp *CrudP) SetOptimistic(enabled bool) {
+	cp.optimistic = enabled
+}
+
+// SetBinaryEnvelope makes the WASM client send and accept batches in the
+// compact binary envelope (MIMEBinary) instead of the configured codec.
+// Entities inside Packet.Data are still encoded with SetCodecs.
+func (cp *CrudP) SetBinaryEnvelope(enabled bool) {
+	cp.binaryEnvelope = enabled
+}
+
+// Compression configures gzip/deflate compression of the server's HTTP bodies
+type Compression struct {
+	MinSize int // Smallest response body compressed, in bytes (0 = 1024)
+	Level   int // compress/flate level (0 = default)
+}
+
+func (c *Compression) minSize() int {
+	if c.MinSize <= 0 {
+		return 1024
+	}
+	return c.MinSize
+}
+
+// SetCompression enables response compression negotiated with Accept-Encoding
+// and decompression of request bodies sent with Content-Encoding, on /batch,
+// /changes and the automatic endpoints. nil disables it.
+func (cp *CrudP) SetCompression(c *Compression) {
+	cp.compression = c
+}
+
+// SetCacheStore configures the store used by the server-side read cache of
+// handlers implementing Cacheable. nil restores the in-memory LRU default.
+func (cp *CrudP) SetCacheStore(store CacheStore) {
+	if store == nil {
+		store = NewLRUCache(0, 0)
+	}
+	cp.cache = store
+}
@@ -0,0 +1,22 @@
+package crudp
+
+// CSRF token names shared by the server and the WASM client
+const (
+	CSRFCookie = "crudp_csrf"   // Cookie holding the token, readable by the client
+	CSRFHeader = "X-CSRF-Token" // Header echoing the token on each request
+)
+
+// CSRF protects the endpoints against cross-site request forgery when
+// callers are authenticated by cookies (e.g. CookieSession).
+type CSRF struct {
+	TrustedOrigins []string // Origins allowed besides the server's own, e.g. "https://admin.example.com"
+	OriginOnly     bool     // Check Origin/Referer only, without the double-submit token
+	Insecure       bool     // Allow the token cookie over plain HTTP (development only)
+}
+
+// SetCSRF enables CSRF protection of POST /batch and the generated
+// POST/PUT/DELETE routes on the server. nil disables it. The WASM client
+// always sends the token when the cookie is present.
+func (cp *CrudP) SetCSRF(c *CSRF) {
+	cp.csrf = c
+}
@@ -0,0 +1,24 @@
+//go:build wasm
+
+package crudp
+
+import (
+	"syscall/js"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// csrfToken reads the CSRF token cookie issued by the server, "" if absent
+func csrfToken() string {
+	document := js.Global().Get("document")
+	if document.IsUndefined() {
+		return ""
+	}
+	for _, pair := range Split(document.Get("cookie").String(), ";") {
+		pair = Convert(pair).TrimSpace().String()
+		if HasPrefix(pair, CSRFCookie+"=") {
+			return pair[len(CSRFCookie)+1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+)
+
+// checkCSRF issues the token cookie when the request has none and
+// verifies unsafe requests: Origin (or Referer) must be the server or a
+// trusted origin, and the token header must match the cookie. Requests with
+// an Authorization header cannot be forged by another site and are not
+// checked.
+func (cp *CrudP) checkCSRF(w http.ResponseWriter, r *http.Request) error {
+	if cp.csrf == nil {
+		return nil
+	}
+	token := cp.csrf.ensureToken(w, r)
+	if token == "" {
+		return &StatusError{Code: 500, Message: "csrf: token unavailable"}
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	if r.Header.Get("Authorization") != "" {
+		return nil
+	}
+
+	if source := r.Header.Get("Origin"); source != "" {
+		if !cp.csrf.trusted(r, source) {
+			return &StatusError{Code: 403, Message: "csrf: origin not allowed"}
+		}
+	} else if source := r.Header.Get("Referer"); source != "" {
+		if !cp.csrf.trusted(r, source) {
+			return &StatusError{Code: 403, Message: "csrf: referer not allowed"}
+		}
+	} else if cp.csrf.OriginOnly {
+		return &StatusError{Code: 403, Message: "csrf: missing origin"}
+	}
+
+	if cp.csrf.OriginOnly {
+		return nil
+	}
+	sent := r.Header.Get(CSRFHeader)
+	if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		return &StatusError{Code: 403, Message: "csrf: invalid token"}
+	}
+	return nil
+}
+
+// CSRFToken returns the request's token, issuing the cookie when it is
+// missing. Server-rendered pages can embed it; the WASM client reads the
+// cookie itself.
+func (cp *CrudP) CSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if cp.csrf == nil {
+		return ""
+	}
+	return cp.csrf.ensureToken(w, r)
+}
+
+// ensureToken returns the token of r. When r has none, a new token cookie
+// is set on w and added to r, so later handlers of the same request reuse
+// it. A request cannot echo a token issued by its own response.
+func (c *CSRF) ensureToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(CSRFCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return ""
+	}
+	// Not HttpOnly: the client echoes it in CSRFHeader
+	cookie := &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(raw),
+		Path:     "/",
+		Secure:   !c.Insecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, cookie)
+	r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	return cookie.Value
+}
+
+// trusted reports whether an Origin or Referer value is the server itself
+// or one of TrustedOrigins
+func (c *CSRF) trusted(r *http.Request, source string) bool {
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false // includes Origin "null"
+	}
+	if u.Host == r.Host {
+		return true
+	}
+	origin := u.Scheme + "://" + u.Host
+	for _, t := range c.TrustedOrigins {
+		if t == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// csrfMiddleware issues the token cookie on every response of handler, so
+// the client has it before its first batch
+func (cp *CrudP) csrfMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cp.csrf != nil {
+			cp.csrf.ensureToken(w, r)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,103 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+func TestCSRF(t *testing.T) {
+	memoStore = map[string]*Memo{"1": {ID: "1", Owner: "bob"}}
+	newServer := func(c *crudp.CSRF) http.Handler {
+		cp := NewTestCrudP()
+		cp.SetCSRF(c)
+		if err := cp.RegisterHandlers(&Memo{}); err != nil {
+			t.Fatalf("RegisterHandlers failed: %v", err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("page")) })
+		cp.RegisterRoutes(mux)
+		return cp.ApplyMiddleware(mux)
+	}
+	batch := func(server http.Handler, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "http://app.example.com/batch", strings.NewReader(`{"packets":[]}`))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+	tokenOf := func(rec *httptest.ResponseRecorder) string {
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == crudp.CSRFCookie {
+				return c.Value
+			}
+		}
+		return ""
+	}
+
+	t.Run("DoubleSubmit", func(t *testing.T) {
+		server := newServer(&crudp.CSRF{})
+
+		// Any response issues the token, once
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", "http://app.example.com/", nil))
+		token := tokenOf(rec)
+		if token == "" || len(rec.Result().Cookies()) != 1 {
+			t.Fatalf("expected one token cookie, got %v", rec.Result().Cookies())
+		}
+
+		cookie := crudp.CSRFCookie + "=" + token
+		if rec := batch(server, nil); rec.Code != http.StatusForbidden || tokenOf(rec) == "" {
+			t.Errorf("expected 403 and a new token without cookie, got %d", rec.Code)
+		}
+		if rec := batch(server, map[string]string{"Cookie": cookie}); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403 without the header, got %d", rec.Code)
+		}
+		if rec := batch(server, map[string]string{"Cookie": cookie, crudp.CSRFHeader: "forged"}); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a wrong token, got %d", rec.Code)
+		}
+		if rec := batch(server, map[string]string{"Cookie": cookie, crudp.CSRFHeader: token}); rec.Code != http.StatusOK {
+			t.Errorf("expected 200 with a matching token, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := batch(server, map[string]string{"Cookie": cookie, crudp.CSRFHeader: token, "Origin": "https://evil.example"}); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a foreign origin, got %d", rec.Code)
+		}
+		if rec := batch(server, map[string]string{"Cookie": cookie, crudp.CSRFHeader: token, "Origin": "https://app.example.com"}); rec.Code != http.StatusOK {
+			t.Errorf("expected 200 for the own origin, got %d", rec.Code)
+		}
+		if rec := batch(server, map[string]string{"Authorization": "Bearer x"}); rec.Code != http.StatusOK {
+			t.Errorf("expected header-authenticated requests to pass, got %d", rec.Code)
+		}
+
+		// Reads are not checked
+		rec = httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", "http://app.example.com/memos/1", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected GET to pass, got %d", rec.Code)
+		}
+	})
+
+	t.Run("OriginOnly", func(t *testing.T) {
+		server := newServer(&crudp.CSRF{OriginOnly: true, TrustedOrigins: []string{"https://admin.example.com"}})
+
+		if rec := batch(server, nil); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403 without origin, got %d", rec.Code)
+		}
+		if rec := batch(server, map[string]string{"Referer": "https://app.example.com/notes"}); rec.Code != http.StatusOK {
+			t.Errorf("expected 200 for a same-site referer, got %d", rec.Code)
+		}
+		if rec := batch(server, map[string]string{"Origin": "https://admin.example.com"}); rec.Code != http.StatusOK {
+			t.Errorf("expected 200 for a trusted origin, got %d", rec.Code)
+		}
+		if rec := batch(server, map[string]string{"Origin": "null"}); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a null origin, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package crudp
+
+import (
+	. "github.com/tinywasm/fmt"
+)
+
+// StatusError is an error carrying an HTTP-like status code. Automatic
+// endpoints use the code as HTTP status and batch results report it in
+// PacketResult.Status.
+type StatusError struct {
+	Code    uint16
+	Message string
+}
+
+func (e *StatusError) Error() string { return e.Message }
+
+// StatusCode returns the HTTP-like status code of the error
+func (e *StatusError) StatusCode() uint16 { return e.Code }
+
+// statusCoder is implemented by errors that map to a protocol status code
+type statusCoder interface {
+	StatusCode() uint16
+}
+
+// statusOf returns the status code carried by err, or 0 if none
+func statusOf(err error) uint16 {
+	if sc, ok := err.(statusCoder); ok {
+		return sc.StatusCode()
+	}
+	return 0
+}
+
+// errorf formats an error like Sprintf. Errf stops writing at the first
+// verb, and a formatted message passed back to Errf would have any '%' of
+// its values parsed again.
+func errorf(format string, args ...any) error {
+	return Err(Sprintf(format, args...))
+}
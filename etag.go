@@ -0,0 +1,83 @@
+package crudp
+
+import (
+	"hash/fnv"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// ifMatch is the entity tag a mutation expects the stored entity to have.
+// It travels in CallHandler data next to the injected request values.
+type ifMatch string
+
+// resultTag returns the ETag of a handler result: the entity version when
+// it implements Versioned, a hash of its encoded data otherwise.
+func resultTag(result any, data [][]byte) string {
+	if v, ok := result.(Versioned); ok {
+		return `"` + v.Version() + `"`
+	}
+	if len(data) == 0 {
+		return ""
+	}
+	h := fnv.New64a()
+	for _, item := range data {
+		h.Write(item)
+		h.Write([]byte{0})
+	}
+	return Sprintf(`"%x"`, h.Sum64())
+}
+
+// tagOf returns the ETag of a result whose encoded data is already known
+func tagOf(result any, data [][]byte) string {
+	if cached, ok := result.(cachedResult); ok {
+		return cached.tag
+	}
+	return resultTag(result, data)
+}
+
+// matchTag reports whether tag satisfies an If-Match/If-None-Match value:
+// "*" or a comma-separated list of tags (weak prefixes are ignored).
+func matchTag(header, tag string) bool {
+	if header == "" || tag == "" {
+		return false
+	}
+	for _, candidate := range Split(header, ",") {
+		candidate = Convert(candidate).TrimSpace().TrimPrefix("W/").String()
+		if candidate == "*" {
+			return true
+		}
+		if candidate == tag || `"`+candidate+`"` == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPrecondition loads the stored entity targeted by an update or delete
+// and fails with 412 when its tag does not satisfy expected. Hash tags are
+// computed on the entity stripped by policy and encoded with c, as the
+// client received it.
+func (cp *CrudP) checkPrecondition(stored *storedEntity, expected ifMatch, c Codec, policy *callPolicy) error {
+	if stored.id == "" || stored.read == nil {
+		return &StatusError{Code: 428, Message: "precondition requires a readable entity id"}
+	}
+
+	current, err := stored.load()
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return &StatusError{Code: 412, Message: "precondition failed: entity not found"}
+	}
+
+	var pr PacketResult
+	if _, ok := current.(Versioned); !ok {
+		if err := cp.encodeResult(&pr, policy.strip(current), c); err != nil {
+			return err
+		}
+	}
+	if !matchTag(string(expected), resultTag(current, pr.Data)) {
+		return &ConflictError{Code: 412, Current: current}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/crudp"
+)
+
+type Doc struct {
+	ID  string `json:"id"`
+	Rev int    `json:"rev"`
+	Txt string `json:"txt"`
+}
+
+func (d *Doc) EntityID() string { return d.ID }
+func (d *Doc) Version() string  { return strconv.Itoa(d.Rev) }
+
+// docStore is the mock database behind the Doc handler
+var docStore map[string]*Doc
+
+func (d *Doc) HandlerName() string { return "docs" }
+func (d *Doc) Read(id string) (any, error) {
+	if doc, ok := docStore[id]; ok {
+		return doc, nil
+	}
+	return nil, nil
+}
+func (d *Doc) List() (any, error) { return nil, nil }
+func (d *Doc) Create(payload any) (any, error) {
+	v := payload.(*Doc)
+	docStore[v.ID] = v
+	return v, nil
+}
+func (d *Doc) Update(payload any) (any, error) {
+	v := payload.(*Doc)
+	stored := *v
+	stored.Rev = docStore[v.ID].Rev + 1
+	docStore[v.ID] = &stored
+	return &stored, nil
+}
+func (d *Doc) Delete(id string) error {
+	delete(docStore, id)
+	return nil
+}
+func (d *Doc) ValidateData(action byte, payload any) error { return nil }
+func (d *Doc) AllowedRoles(action byte) []byte             { return []byte{'*'} }
+
+func newDocServer(t *testing.T) (*crudp.CrudP, *http.ServeMux) {
+	docStore = map[string]*Doc{"1": {ID: "1", Rev: 3, Txt: "hello"}}
+	cp := NewTestCrudP()
+	if err := cp.RegisterHandlers(&Doc{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	cp.RegisterRoutes(mux)
+	return cp, mux
+}
+
+func TestETag(t *testing.T) {
+	t.Run("GET Emits ETag And Honors If-None-Match", func(t *testing.T) {
+		_, mux := newDocServer(t)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/docs/1", nil))
+		if tag := rec.Header().Get("ETag"); tag != `"3"` {
+			t.Fatalf("expected ETag \"3\", got %q", tag)
+		}
+
+		req := httptest.NewRequest("GET", "/docs/1", nil)
+		req.Header.Set("If-None-Match", `"3"`)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("expected 304, got %d", rec.Code)
+		}
+	})
+
+	t.Run("PUT With Stale If-Match", func(t *testing.T) {
+		_, mux := newDocServer(t)
+
+		var body []byte
+		jsonEncode(crudp.Request{Data: [][]byte{[]byte(`{"id":"1","txt":"edit"}`)}}, &body)
+		req := httptest.NewRequest("PUT", "/docs/1", httpBodyFromBytes(body))
+		req.Header.Set("If-Match", `"2"`)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected 412, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if docStore["1"].Txt != "hello" {
+			t.Error("stale update must not be applied")
+		}
+
+		req = httptest.NewRequest("PUT", "/docs/1", httpBodyFromBytes(body))
+		req.Header.Set("If-Match", `"3"`)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"4"` {
+			t.Errorf("expected 200 with ETag \"4\", got %d %q", rec.Code, rec.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("Batch Version Field", func(t *testing.T) {
+		cp, _ := newDocServer(t)
+
+		resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{
+			{Action: 'r', ReqID: "r1", Version: `"3"`},
+		}}, "1")
+		if res := resp.Results[0]; res.Status != 304 || len(res.Data) != 0 {
+			t.Errorf("expected 304 without data, got %d with %d items", res.Status, len(res.Data))
+		}
+
+		resp, _ = cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{
+			{Action: 'd', ReqID: "d1", Version: `"1"`},
+		}}, "1")
+		if res := resp.Results[0]; res.Status != 412 {
+			t.Errorf("expected 412 for stale delete, got %d: %s", res.Status, res.Message)
+		}
+	})
+}
+
+func TestVersionConflict(t *testing.T) {
+	cp, _ := newDocServer(t)
+
+	update := func(rev int) crudp.PacketResult {
+		var data []byte
+		jsonEncode(&Doc{ID: "1", Rev: rev, Txt: "edit"}, &data)
+		resp, err := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{
+			{Action: 'u', ReqID: "u1", Data: [][]byte{data}},
+		}})
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		return resp.Results[0]
+	}
+
+	res := update(2)
+	if res.Status != 409 {
+		t.Fatalf("expected 409 conflict, got %d: %s", res.Status, res.Message)
+	}
+	var current Doc
+	if len(res.Data) != 1 || jsonDecode(res.Data[0], &current) != nil || current.Rev != 3 || current.Txt != "hello" {
+		t.Errorf("expected the server copy in Data, got %s", res.Data)
+	}
+	if res.Version != `"3"` {
+		t.Errorf("expected current version \"3\", got %q", res.Version)
+	}
+
+	res = update(3)
+	if res.MessageType != 4 || docStore["1"].Rev != 4 {
+		t.Errorf("expected update with current version to succeed, got %d: %s", res.Status, res.Message)
+	}
+}
+
+// Ledger is a versioned entity whose Update is slow, to widen the window
+// between the version check and the write
+type Ledger struct {
+	ID  string `json:"id"`
+	Rev int    `json:"rev"`
+}
+
+var ledgerMu sync.Mutex
+var ledgerStore map[string]Ledger
+
+func (l *Ledger) EntityID() string    { return l.ID }
+func (l *Ledger) Version() string     { return strconv.Itoa(l.Rev) }
+func (l *Ledger) HandlerName() string { return "ledgers" }
+func (l *Ledger) Read(id string) (any, error) {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	stored := ledgerStore[id]
+	return &stored, nil
+}
+func (l *Ledger) List() (any, error) { return nil, nil }
+func (l *Ledger) Update(payload any) (any, error) {
+	time.Sleep(10 * time.Millisecond)
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	v := *payload.(*Ledger)
+	v.Rev = ledgerStore[v.ID].Rev + 1
+	ledgerStore[v.ID] = v
+	return &v, nil
+}
+func (l *Ledger) ValidateData(action byte, payload any) error { return nil }
+func (l *Ledger) AllowedRoles(action byte) []byte             { return []byte{'*'} }
+
+func TestConcurrentVersionedUpdates(t *testing.T) {
+	ledgerStore = map[string]Ledger{"1": {ID: "1", Rev: 1}}
+	cp := NewTestCrudP()
+	if err := cp.RegisterHandlers(&Ledger{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cp.CallHandler(0, 'u', &Ledger{ID: "1", Rev: 1})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	applied := 0
+	for err := range errs {
+		if err == nil {
+			applied++
+		} else if conflict, ok := err.(*crudp.ConflictError); !ok || conflict.Code != 409 {
+			t.Errorf("expected a version conflict, got %v", err)
+		}
+	}
+	if applied != 1 || ledgerStore["1"].Rev != 2 {
+		t.Errorf("expected exactly one write of version 1, got %d writes (rev %d)", applied, ledgerStore["1"].Rev)
+	}
+}
+
+func TestConflictResolution(t *testing.T) {
+	update := func(cp *crudp.CrudP, doc *Doc) crudp.PacketResult {
+		var data []byte
+		jsonEncode(doc, &data)
+		resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'u', Data: [][]byte{data}}}})
+		return resp.Results[0]
+	}
+
+	t.Run("Server Wins", func(t *testing.T) {
+		cp, _ := newDocServer(t)
+		cp.SetConflictResolver("docs", crudp.ServerWins())
+
+		res := update(cp, &Doc{ID: "1", Rev: 2, Txt: "stale"})
+		if res.MessageType != 4 || res.Resolution != crudp.ResolutionServerWins {
+			t.Fatalf("expected resolved success, got %q: %s", res.Resolution, res.Message)
+		}
+		if docStore["1"].Txt != "hello" || docStore["1"].Rev != 3 {
+			t.Error("server copy must be kept")
+		}
+	})
+
+	t.Run("Field Merge", func(t *testing.T) {
+		cp, _ := newDocServer(t)
+		cp.SetConflictResolver("docs", crudp.FieldMerge())
+
+		res := update(cp, &Doc{ID: "1", Rev: 2, Txt: "merged"})
+		if res.Resolution != crudp.ResolutionMerged {
+			t.Fatalf("expected merged resolution, got %q: %s", res.Resolution, res.Message)
+		}
+		if docStore["1"].Txt != "merged" || docStore["1"].Rev != 4 {
+			t.Errorf("expected merged copy to be written, got %+v", docStore["1"])
+		}
+	})
+
+	t.Run("Custom Callback Rejects", func(t *testing.T) {
+		cp, _ := newDocServer(t)
+		cp.SetConflictResolver("docs", func(server, client any) (any, string, error) {
+			return nil, "", &crudp.StatusError{Code: 409, Message: "manual review required"}
+		})
+
+		res := update(cp, &Doc{ID: "1", Rev: 2})
+		if res.Status != 409 || res.Message != "manual review required" {
+			t.Errorf("expected custom rejection, got %d: %s", res.Status, res.Message)
+		}
+	})
+}
@@ -12,10 +12,21 @@ func (cp *CrudP) Execute(req *BatchRequest, inject ...any) (*BatchResponse, erro
 	if req == nil {
 		return nil, Errf("request is nil")
 	}
+	if err := cp.checkBatch(req); err != nil {
+		return nil, err
+	}
 
 	results := make([]PacketResult, 0, len(req.Packets))
 
 	for _, p := range req.Packets {
+		if p.Action == 's' || p.Action == '+' || p.Action == '-' {
+			results = append(results, cp.executeChannel(&p, inject...)...)
+			continue
+		}
+		if p.Action == 'c' && p.IdempotencyKey != "" {
+			results = append(results, cp.executeOnce(&p, inject...))
+			continue
+		}
 		result := cp.executeSingle(&p, inject...)
 		results = append(results, result)
 	}
@@ -25,34 +36,103 @@ func (cp *CrudP) Execute(req *BatchRequest, inject ...any) (*BatchResponse, erro
 	}, nil
 }
 
+// executeChannel runs sync ('s') and subscription ('+', '-') packets. They
+// do not reach CallHandler, so they are audited here.
+func (cp *CrudP) executeChannel(p *Packet, inject ...any) []PacketResult {
+	var entry *AuditEntry
+	if cp.auditSink != nil && int(p.HandlerID) < len(cp.handlers) {
+		entry = cp.newAuditEntry(cp.handlers[p.HandlerID], p.Action, inject...)
+	}
+
+	var results []PacketResult
+	var err error
+	if p.Action == 's' {
+		results, err = cp.executeSync(p, entry, inject...)
+	} else {
+		var pr PacketResult
+		pr, err = cp.executeSubscription(p, entry, inject...)
+		results = []PacketResult{pr}
+	}
+
+	if entry != nil {
+		cp.audit(entry, nil, err)
+	}
+	return results
+}
+
+// admit applies the CallHandler checks that hold for sync and subscription
+// packets: rate limit, read access and tenant membership. It returns the
+// caller's tenant.
+func (cp *CrudP) admit(handler actionHandler, action byte, entry *AuditEntry, inject ...any) (string, error) {
+	if err := cp.checkRateLimit(handler, action, inject...); err != nil {
+		entry.deny()
+		return "", err
+	}
+	if err := cp.accessCheck(handler, 'r', inject...); err != nil {
+		entry.deny()
+		return "", err
+	}
+	tenant := cp.tenantOf(inject...)
+	if handler.tenantScoped && cp.getTenant != nil && tenant == "" {
+		entry.deny()
+		return "", &StatusError{Code: 400, Message: "tenant required"}
+	}
+	if err := cp.authorizeTenant(tenant, inject...); err != nil {
+		entry.deny()
+		return "", err
+	}
+	return tenant, nil
+}
+
 func (cp *CrudP) executeSingle(p *Packet, inject ...any) PacketResult {
 	pr := PacketResult{
 		Packet: *p,
 	}
 
 	// Decode data
-	decodedData, err := cp.decodeWithKnownType(p, p.HandlerID)
+	codec := cp.codecFrom(inject)
+	if err := cp.checkItems(p.Data); err != nil {
+		cp.setError(&pr, err, codec.out)
+		return pr
+	}
+	decodedData, err := cp.decodeWithKnownType(p, p.HandlerID, codec.in)
 	if err != nil {
-		pr.MessageType = uint8(Msg.Error)
-		pr.Message = err.Error()
+		cp.setError(&pr, err, codec.out)
 		return pr
 	}
 
 	// Prepend inject values to decoded data
 	allData := append(inject, decodedData...)
+	if p.Version != "" && (p.Action == 'u' || p.Action == 'd') {
+		allData = append(allData, ifMatch(p.Version))
+	}
+	outcome := &resolution{}
+	allData = append(allData, outcome)
 
 	// Call handler
 	result, err := cp.CallHandler(p.HandlerID, p.Action, allData...)
+	pr.Resolution = outcome.outcome
 	if err != nil {
-		pr.MessageType = uint8(Msg.Error)
-		pr.Message = err.Error()
+		cp.setError(&pr, err, codec.out)
 		return pr
 	}
 
 	// Encode result to Data
-	if err := cp.encodeResult(&pr, result); err != nil {
-		pr.MessageType = uint8(Msg.Error)
-		pr.Message = err.Error()
+	if err := cp.encodeResult(&pr, result, codec.out); err != nil {
+		cp.setError(&pr, err, codec.out)
+		return pr
+	}
+
+	if result != nil {
+		pr.Version = tagOf(result, pr.Data)
+	}
+
+	// Conditional read: the client already holds the current version
+	if p.Action == 'r' && result != nil && matchTag(p.Version, pr.Version) {
+		pr.Data = nil
+		pr.MessageType = uint8(Msg.Info)
+		pr.Message = "not modified"
+		pr.Status = 304
 		return pr
 	}
 
@@ -61,12 +141,18 @@ func (cp *CrudP) executeSingle(p *Packet, inject ...any) PacketResult {
 	return pr
 }
 
-func (cp *CrudP) encodeResult(pr *PacketResult, result any) error {
+// encodeResult encodes a handler result into pr.Data with codec c
+func (cp *CrudP) encodeResult(pr *PacketResult, result any, c Codec) error {
 	if result == nil {
 		return nil
 	}
 
-	if cp.encode == nil {
+	if cached, ok := result.(cachedResult); ok {
+		pr.Data = cached.data
+		return nil
+	}
+
+	if c.Encode == nil {
 		return Errf("encode function not configured")
 	}
 
@@ -76,7 +162,7 @@ func (cp *CrudP) encodeResult(pr *PacketResult, result any) error {
 		pr.Data = make([][]byte, 0, v.Len())
 		for i := 0; i < v.Len(); i++ {
 			var encoded []byte
-			if err := cp.encode(v.Index(i).Interface(), &encoded); err != nil {
+			if err := c.Encode(v.Index(i).Interface(), &encoded); err != nil {
 				return err
 			}
 			pr.Data = append(pr.Data, encoded)
@@ -86,7 +172,7 @@ func (cp *CrudP) encodeResult(pr *PacketResult, result any) error {
 
 	// Single item
 	var encoded []byte
-	if err := cp.encode(result, &encoded); err != nil {
+	if err := c.Encode(result, &encoded); err != nil {
 		return err
 	}
 	pr.Data = [][]byte{encoded}
@@ -2,8 +2,14 @@
 
 package crudp
 
+import (
+	. "github.com/tinywasm/fmt"
+)
+
 // HandleResponse processes a BatchResponse by converting it back to a BatchRequest
 // and executing it locally on the WASM side.
+// Results of optimistic packets are settled instead: confirmed ones are
+// replaced by the server copy and rejected ones are rolled back.
 func (cp *CrudP) HandleResponse(resp *BatchResponse) {
 	if resp == nil {
 		return
@@ -14,6 +20,31 @@ func (cp *CrudP) HandleResponse(resp *BatchResponse) {
 	}
 
 	for _, res := range resp.Results {
+		if res.Action == 's' {
+			if res.MessageType == uint8(Msg.Success) {
+				cp.SetSyncCursor(res.HandlerID, res.Cursor)
+			} else if res.Status == 410 {
+				cp.resync(res.HandlerID, res.Cursor)
+			} else {
+				cp.log("sync failed for handler:", cp.GetHandlerName(res.HandlerID), res.Message)
+			}
+			continue
+		}
+		if res.Action == '+' || res.Action == '-' {
+			if res.MessageType == uint8(Msg.Error) {
+				cp.log("subscription failed for handler:", cp.GetHandlerName(res.HandlerID), res.Message)
+			}
+			continue
+		}
+		cp.updateCache(&res)
+		if sent, ok := cp.takePending(res.ReqID); ok {
+			if res.MessageType == uint8(Msg.Error) {
+				cp.rollback(&sent, &res)
+			} else {
+				cp.confirm(&sent, &res)
+			}
+			continue
+		}
 		req.Packets = append(req.Packets, res.Packet)
 	}
 
@@ -21,3 +52,159 @@ func (cp *CrudP) HandleResponse(resp *BatchResponse) {
 	// as handlers update the DOM directly via tinywasm/dom
 	_, _ = cp.Execute(req)
 }
+
+// applyOptimistic executes mutation packets on the local handlers before they
+// reach the server and tracks them until their results arrive.
+func (cp *CrudP) applyOptimistic(req *BatchRequest) {
+	if !cp.optimistic {
+		return
+	}
+
+	for _, p := range req.Packets {
+		if p.ReqID == "" || (p.Action != 'c' && p.Action != 'u' && p.Action != 'd') {
+			continue
+		}
+
+		res := cp.executeSingle(&p)
+		if res.MessageType == uint8(Msg.Error) {
+			cp.log("optimistic apply failed:", p.ReqID, res.Message)
+			continue
+		}
+
+		cp.InvalidateCache(p.HandlerID)
+
+		cp.clientMu.Lock()
+		if cp.pending == nil {
+			cp.pending = make(map[string]Packet)
+		}
+		cp.pending[p.ReqID] = p
+		cp.clientMu.Unlock()
+	}
+}
+
+// takePending removes and returns the optimistic packet tracked under reqID.
+func (cp *CrudP) takePending(reqID string) (Packet, bool) {
+	if reqID == "" {
+		return Packet{}, false
+	}
+
+	cp.clientMu.Lock()
+	defer cp.clientMu.Unlock()
+
+	p, ok := cp.pending[reqID]
+	if ok {
+		delete(cp.pending, reqID)
+	}
+	return p, ok
+}
+
+// confirm applies the server copy of an accepted optimistic create or update:
+// the server may have set its id, version or other fields. A create the
+// server stored under another id replaces the locally created entity.
+func (cp *CrudP) confirm(sent *Packet, res *PacketResult) {
+	if sent.Action == 'd' || len(res.Data) == 0 || int(sent.HandlerID) >= len(cp.handlers) {
+		return
+	}
+	handler := cp.handlers[sent.HandlerID]
+	server, err := cp.decodeEntity(handler, res.Data[0])
+	if err != nil {
+		cp.log("confirm failed:", sent.ReqID, err)
+		return
+	}
+
+	action := byte('u')
+	if sent.Action == 'c' && idOf(server) != idOf(cp.sentPayload(sent)) {
+		if !cp.removeCreated(handler, sent) {
+			return
+		}
+		action = 'c'
+	}
+	if err := cp.applyServerCopy(handler, action, server); err != nil {
+		cp.log("confirm failed:", sent.ReqID, err)
+	}
+	cp.InvalidateCache(sent.HandlerID)
+}
+
+// rollback reverts an optimistic packet rejected by the server.
+// Handlers implementing Rollbacker receive the locally applied payload.
+// Otherwise, when the server sent its authoritative copy in res.Data, the
+// local handler is re-run with it, and a create without one is deleted
+// locally. res is nil when the batch never reached the server.
+func (cp *CrudP) rollback(sent *Packet, res *PacketResult) {
+	if int(sent.HandlerID) >= len(cp.handlers) {
+		return
+	}
+	handler := cp.handlers[sent.HandlerID]
+	defer cp.InvalidateCache(sent.HandlerID)
+
+	if handler.Rollback != nil {
+		if err := handler.Rollback(sent.Action, cp.sentPayload(sent)); err != nil {
+			cp.log("rollback failed:", sent.ReqID, err)
+		}
+		return
+	}
+
+	if res != nil && len(res.Data) > 0 {
+		// Restore a rejected delete, overwrite anything else
+		action := byte('u')
+		if sent.Action == 'd' {
+			action = 'c'
+		}
+		server, err := cp.decodeEntity(handler, res.Data[0])
+		if err == nil {
+			err = cp.applyServerCopy(handler, action, server)
+		}
+		if err != nil {
+			cp.log("rollback failed:", sent.ReqID, err)
+		}
+		return
+	}
+
+	if sent.Action == 'c' {
+		cp.removeCreated(handler, sent)
+		return
+	}
+	cp.log("optimistic change rejected without rollback:", sent.ReqID)
+}
+
+// sentPayload decodes the payload of a sent packet, nil when it has none
+func (cp *CrudP) sentPayload(sent *Packet) any {
+	if decoded, err := cp.decodeWithKnownType(sent, sent.HandlerID, cp.defaultCodec()); err == nil && len(decoded) > 0 {
+		return decoded[0]
+	}
+	return nil
+}
+
+// removeCreated undoes an optimistic create with Rollback, or with Delete of
+// the created id. It reports whether the local entity is gone.
+func (cp *CrudP) removeCreated(handler actionHandler, sent *Packet) bool {
+	payload := cp.sentPayload(sent)
+	var err error
+	switch {
+	case handler.Rollback != nil:
+		err = handler.Rollback('c', payload)
+	case handler.Delete != nil && idOf(payload) != "":
+		err = handler.Delete(idOf(payload))
+	default:
+		err = Errf("handler cannot remove it: implement Rollbacker")
+	}
+	if err != nil {
+		cp.log("optimistic create not removed:", sent.ReqID, err)
+		return false
+	}
+	return true
+}
+
+// applyServerCopy writes an entity received from the server to the local
+// handler. The server already checked it: access and version checks are skipped.
+func (cp *CrudP) applyServerCopy(handler actionHandler, action byte, entity any) error {
+	write := handler.Update
+	if action == 'c' {
+		write = handler.Create
+	}
+	if write == nil {
+		return errorf("handler %s cannot apply '%c'", handler.name, action)
+	}
+	_, err := write(entity)
+	return err
+}
@@ -0,0 +1,153 @@
+//go:build wasm
+
+package crudp_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+// Note is the local (client) store of an optimistic handler
+type Note struct {
+	ID  string `json:"id"`
+	Rev int    `json:"rev"`
+	Txt string `json:"txt"`
+}
+
+var noteStore map[string]*Note
+
+func (n *Note) EntityID() string    { return n.ID }
+func (n *Note) Version() string     { return strconv.Itoa(n.Rev) }
+func (n *Note) HandlerName() string { return "notes" }
+func (n *Note) Create(payload any) (any, error) {
+	note := payload.(*Note)
+	noteStore[note.ID] = note
+	return note, nil
+}
+func (n *Note) Read(id string) (any, error) { return noteStore[id], nil }
+func (n *Note) List() (any, error)          { return nil, nil }
+func (n *Note) Update(payload any) (any, error) {
+	note := payload.(*Note)
+	noteStore[note.ID] = note
+	return note, nil
+}
+func (n *Note) Delete(id string) error {
+	delete(noteStore, id)
+	return nil
+}
+func (n *Note) ValidateData(byte, any) error    { return nil }
+func (n *Note) AllowedRoles(action byte) []byte { return []byte{'*'} }
+
+// Draft reverts optimistic changes itself
+type Draft struct {
+	ID  string `json:"id"`
+	Rev int    `json:"rev"`
+}
+
+var rolledBack []string
+
+func (d *Draft) HandlerName() string             { return "drafts" }
+func (d *Draft) Create(payload any) (any, error) { return payload, nil }
+func (d *Draft) Read(id string) (any, error)     { return nil, nil }
+func (d *Draft) List() (any, error)              { return nil, nil }
+func (d *Draft) Update(payload any) (any, error) { return payload, nil }
+func (d *Draft) ValidateData(byte, any) error    { return nil }
+func (d *Draft) AllowedRoles(action byte) []byte { return []byte{'*'} }
+func (d *Draft) Rollback(action byte, payload any) error {
+	rolledBack = append(rolledBack, string(action)+":"+payload.(*Draft).ID)
+	return nil
+}
+
+func TestOptimisticSettlement(t *testing.T) {
+	setup := func(t *testing.T) *crudp.CrudP {
+		noteStore = map[string]*Note{"1": {ID: "1", Rev: 1, Txt: "a"}}
+		rolledBack = nil
+		cp := NewTestCrudP()
+		cp.SetOptimistic(true)
+		if err := cp.RegisterHandlers(&Note{}, &Draft{}); err != nil {
+			t.Fatalf("RegisterHandlers failed: %v", err)
+		}
+		return cp
+	}
+	packet := func(action byte, handlerID uint8, reqID string, v any) crudp.Packet {
+		var data []byte
+		jsonEncode(v, &data)
+		return crudp.Packet{Action: action, HandlerID: handlerID, ReqID: reqID, Data: [][]byte{data}}
+	}
+	settle := func(cp *crudp.CrudP, p crudp.Packet, ok bool, server *Note) {
+		res := crudp.PacketResult{Packet: p, MessageType: 4, Message: "OK"}
+		if !ok {
+			res.MessageType, res.Message, res.Status = 2, "rejected", 409
+		}
+		res.Data = nil
+		if server != nil {
+			var data []byte
+			jsonEncode(server, &data)
+			res.Data = [][]byte{data}
+		}
+		cp.HandleResponse(&crudp.BatchResponse{Results: []crudp.PacketResult{res}})
+	}
+
+	t.Run("Applied Before The Server Answers", func(t *testing.T) {
+		cp := setup(t)
+		cp.ApplyOptimistic(&crudp.BatchRequest{Packets: []crudp.Packet{
+			packet('u', 0, "u1", &Note{ID: "1", Rev: 1, Txt: "b"}),
+			packet('c', 0, "", &Note{ID: "2"}), // no ReqID: not tracked, not applied
+		}})
+		if noteStore["1"].Txt != "b" {
+			t.Errorf("expected the update applied locally, got %+v", noteStore["1"])
+		}
+		if _, ok := noteStore["2"]; ok {
+			t.Error("packets without a ReqID must not be applied")
+		}
+	})
+
+	t.Run("Confirmed Results Replace The Local Copy", func(t *testing.T) {
+		cp := setup(t)
+		update := packet('u', 0, "u1", &Note{ID: "1", Rev: 1, Txt: "b"})
+		cp.ApplyOptimistic(&crudp.BatchRequest{Packets: []crudp.Packet{update}})
+		settle(cp, update, true, &Note{ID: "1", Rev: 2, Txt: "b"})
+		if n := noteStore["1"]; n.Rev != 2 {
+			t.Errorf("expected the server version applied, got %+v", n)
+		}
+
+		// The server assigned another id to the create
+		create := packet('c', 0, "c1", &Note{ID: "tmp", Txt: "new"})
+		cp.ApplyOptimistic(&crudp.BatchRequest{Packets: []crudp.Packet{create}})
+		settle(cp, create, true, &Note{ID: "7", Rev: 1, Txt: "new"})
+		if _, ok := noteStore["tmp"]; ok || noteStore["7"] == nil {
+			t.Errorf("expected the local create replaced by the server copy, got %+v", noteStore)
+		}
+	})
+
+	t.Run("Rejected Changes Are Reverted", func(t *testing.T) {
+		cp := setup(t)
+		update := packet('u', 0, "u1", &Note{ID: "1", Rev: 1, Txt: "b"})
+		create := packet('c', 0, "c1", &Note{ID: "2", Txt: "new"})
+		cp.ApplyOptimistic(&crudp.BatchRequest{Packets: []crudp.Packet{update, create}})
+
+		settle(cp, update, false, &Note{ID: "1", Rev: 3, Txt: "server"})
+		if n := noteStore["1"]; n.Txt != "server" || n.Rev != 3 {
+			t.Errorf("expected the server copy restored, got %+v", n)
+		}
+		settle(cp, create, false, nil)
+		if _, ok := noteStore["2"]; ok {
+			t.Error("a rejected create without server data must be removed")
+		}
+	})
+
+	t.Run("Rollbacker", func(t *testing.T) {
+		cp := setup(t)
+		update := packet('u', 1, "u1", &Draft{ID: "1", Rev: 1})
+		create := packet('c', 1, "c1", &Draft{ID: "2"})
+		cp.ApplyOptimistic(&crudp.BatchRequest{Packets: []crudp.Packet{update, create}})
+
+		settle(cp, update, false, &Note{ID: "1", Rev: 3})
+		cp.FailPacket("c1")
+		if len(rolledBack) != 2 || rolledBack[0] != "u:1" || rolledBack[1] != "c:2" {
+			t.Errorf("expected both changes rolled back by the handler, got %q", rolledBack)
+		}
+	})
+}
@@ -0,0 +1,260 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"net/http"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Explanation is the decision of the access check for one handler action,
+// with the rule that made it
+type Explanation struct {
+	Handler        string        `json:"handler"`
+	Action         byte          `json:"action"`
+	UserID         string        `json:"user_id"`
+	Roles          string        `json:"roles"`           // Caller's roles
+	EffectiveRoles string        `json:"effective_roles"` // Roles expanded by the role hierarchy
+	AllowedRoles   string        `json:"allowed_roles"`   // AllowedRoles(Action) of the handler
+	Check          string        `json:"check"`           // "dev mode", "policies", "external", "roles" or "none"
+	Allowed        bool          `json:"allowed"`
+	Reason         string        `json:"reason"`
+	Steps          []ExplainStep `json:"steps"` // Verdict of each policy evaluated, in order
+}
+
+// ExplainStep is the verdict of one policy of SetAccessPolicies
+type ExplainStep struct {
+	Policy   int    `json:"policy"`   // Index of the policy in the chain
+	Decision string `json:"decision"` // "allow", "deny" or "abstain"
+	Reason   string `json:"reason"`
+}
+
+// MatrixRow lists the roles that may run an action of a handler
+type MatrixRow struct {
+	Handler string `json:"handler"`
+	Action  byte   `json:"action"`
+	Allowed string `json:"allowed"`
+	Denied  string `json:"denied"`
+}
+
+// ExplainRoute is the path prefix of the explain endpoints
+const ExplainRoute = "/_access"
+
+// SetExplainAccess enables GET /_access/explain and GET /_access/matrix for
+// callers having any of adminRoles (anyone in dev mode). Call it before
+// RegisterRoutes. nil disables the endpoints.
+func (cp *CrudP) SetExplainAccess(adminRoles []byte) {
+	cp.explainRoles = adminRoles
+}
+
+// Explain simulates the access check of action on the handler named
+// handler for a caller with userID and roles (before the role hierarchy).
+// data is optional request data for the policies, e.g. the id and payload
+// read by RecordOwner. Record and field policies are not evaluated.
+func (cp *CrudP) Explain(handler string, action byte, userID string, roles []byte, data ...any) (*Explanation, error) {
+	h, ok := cp.handlerNamed(handler)
+	if !ok {
+		return nil, &StatusError{Code: 404, Message: "unknown handler: " + handler}
+	}
+	if !h.implements(action) {
+		return nil, &StatusError{Code: 400, Message: "action not implemented: " + string(action)}
+	}
+	return cp.explain(h, action, userID, roles, callerData(userID, roles, "", data)...), nil
+}
+
+// AccessMatrix evaluates every implemented action of every handler for each
+// role on its own (plus the roles it implies). nil roles uses every role
+// named by AllowedRoles and the role hierarchy.
+func (cp *CrudP) AccessMatrix(roles []byte) []MatrixRow {
+	if roles == nil {
+		roles = cp.knownRoles()
+	}
+
+	var rows []MatrixRow
+	for _, h := range cp.handlers {
+		if h.name == "" {
+			continue
+		}
+		for _, action := range []byte{'c', 'r', 'u', 'd'} {
+			if !h.implements(action) {
+				continue
+			}
+			row := MatrixRow{Handler: h.name, Action: action}
+			for _, role := range roles {
+				single := []byte{role}
+				if cp.explain(h, action, "", single, callerData("", single, "", nil)...).Allowed {
+					row.Allowed += string(role)
+				} else {
+					row.Denied += string(role)
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// explain runs the access check of doAccessCheck; roles are the caller's
+// own roles
+func (cp *CrudP) explain(handler actionHandler, action byte, userID string, roles []byte, data ...any) *Explanation {
+	effective := cp.effectiveRoles(roles)
+	e := &Explanation{
+		Handler:        handler.name,
+		Action:         action,
+		UserID:         userID,
+		Roles:          string(roles),
+		EffectiveRoles: string(effective),
+	}
+	if handler.AllowedRoles != nil {
+		e.AllowedRoles = string(handler.AllowedRoles(action))
+	}
+
+	switch {
+	case cp.devMode:
+		e.Check, e.Allowed, e.Reason = "dev mode", true, "dev mode bypasses access checks"
+
+	case cp.policies != nil:
+		e.Check = "policies"
+		req := cp.accessRequest(handler, action, userID, effective, data...)
+		var verdicts []Verdict
+		e.Allowed, e.Reason, verdicts = cp.policies.decide(req)
+		for i, v := range verdicts {
+			e.Steps = append(e.Steps, ExplainStep{Policy: i, Decision: v.Decision.String(), Reason: v.Reason})
+		}
+
+	case cp.accessCheckFn != nil:
+		e.Check = "external"
+		e.Allowed = cp.accessCheckFn(handler.name, action, data...)
+		e.Reason = "denied by external check"
+		if e.Allowed {
+			e.Reason = "external check granted"
+		}
+
+	case handler.AllowedRoles == nil:
+		e.Check, e.Allowed, e.Reason = "none", true, "handler has no AllowedRoles"
+
+	default:
+		e.Check = "roles"
+		e.Allowed = hasAnyRole(effective, []byte(e.AllowedRoles))
+		e.Reason = "role granted"
+		if !e.Allowed {
+			e.Reason = Sprintf("required roles %q, user has %q", e.AllowedRoles, e.EffectiveRoles)
+		}
+	}
+	return e
+}
+
+// roleBytes converts the roles of an Explanation back, nil when empty
+func roleBytes(roles string) []byte {
+	if roles == "" {
+		return nil
+	}
+	return []byte(roles)
+}
+
+func (cp *CrudP) handlerNamed(name string) (actionHandler, bool) {
+	for _, h := range cp.handlers {
+		if h.name != "" && h.name == name {
+			return h, true
+		}
+	}
+	return actionHandler{}, false
+}
+
+// knownRoles returns the roles of AllowedRoles and the role hierarchy, in
+// byte order
+func (cp *CrudP) knownRoles() []byte {
+	var seen [256]bool
+	for role, implied := range cp.roleHierarchy {
+		seen[role] = true
+		for _, r := range implied {
+			seen[r] = true
+		}
+	}
+	for _, h := range cp.handlers {
+		if h.AllowedRoles == nil {
+			continue
+		}
+		for _, action := range []byte{'c', 'r', 'u', 'd'} {
+			if h.implements(action) {
+				for _, r := range h.AllowedRoles(action) {
+					seen[r] = true
+				}
+			}
+		}
+	}
+	seen['*'] = false // any role, not a role itself
+	var roles []byte
+	for r := range seen {
+		if seen[r] {
+			roles = append(roles, byte(r))
+		}
+	}
+	return roles
+}
+
+// handleExplain serves GET /_access/explain?handler=&action=&user=&roles=
+func (cp *CrudP) handleExplain(w http.ResponseWriter, r *http.Request) {
+	if !cp.explainAllowed(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	action := q.Get("action")
+	if len(action) != 1 {
+		http.Error(w, "invalid action", http.StatusBadRequest)
+		return
+	}
+	e, err := cp.Explain(q.Get("handler"), action[0], q.Get("user"), []byte(q.Get("roles")))
+	if err != nil {
+		http.Error(w, err.Error(), int(statusOf(err)))
+		return
+	}
+	cp.writeExplain(w, r, e)
+}
+
+// handleMatrix serves GET /_access/matrix?roles=
+func (cp *CrudP) handleMatrix(w http.ResponseWriter, r *http.Request) {
+	if !cp.explainAllowed(w, r) {
+		return
+	}
+	var roles []byte
+	if v := r.URL.Query().Get("roles"); v != "" {
+		roles = []byte(v)
+	}
+	cp.writeExplain(w, r, cp.AccessMatrix(roles))
+}
+
+// explainAllowed restricts the explain endpoints to SetExplainAccess roles
+func (cp *CrudP) explainAllowed(w http.ResponseWriter, r *http.Request) bool {
+	ctx, ok := cp.requestContext(w, r)
+	if !ok {
+		return false
+	}
+	if cp.devMode {
+		return true
+	}
+	var roles []byte
+	if cp.getUserRoles != nil {
+		roles = cp.effectiveRoles(cp.getUserRoles(ctx, r))
+	}
+	if !hasAnyRole(roles, cp.explainRoles) {
+		cp.log("access denied for endpoint:", r.URL.Path)
+		http.Error(w, "access denied", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (cp *CrudP) writeExplain(w http.ResponseWriter, r *http.Request, report any) {
+	if cp.encode == nil {
+		http.Error(w, "encode function not configured", http.StatusInternalServerError)
+		return
+	}
+	encoded, err := cp.encodeBody(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cp.writeBody(w, r, 0, cp.defaultCodec().MIME, encoded)
+}
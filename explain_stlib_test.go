@@ -0,0 +1,125 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+func TestExplainAccess(t *testing.T) {
+	memoStore = map[string]*Memo{
+		"1": {ID: "1", Owner: "bob"},
+		"2": {ID: "2", Owner: "carol"},
+	}
+	roles := "e"
+	newServer := func() (*crudp.CrudP, *http.ServeMux) {
+		cp := NewTestCrudP()
+		cp.SetDevMode(false)
+		cp.SetUserRoles(func(data ...any) []byte { return []byte(roles) })
+		cp.SetRoleHierarchy(map[byte][]byte{'a': {'e'}, 'e': {'v'}})
+		cp.SetExplainAccess([]byte{'a'})
+		if err := cp.RegisterHandlers(&Memo{}); err != nil {
+			t.Fatalf("RegisterHandlers failed: %v", err)
+		}
+		mux := http.NewServeMux()
+		cp.RegisterRoutes(mux)
+		return cp, mux
+	}
+
+	t.Run("Roles", func(t *testing.T) {
+		cp, _ := newServer()
+
+		e, err := cp.Explain("memos", 'u', "bob", []byte("v"))
+		if err != nil {
+			t.Fatalf("Explain failed: %v", err)
+		}
+		if e.Allowed || e.Check != "roles" || e.Reason != `required roles "ea", user has "v"` {
+			t.Errorf("unexpected explanation: %+v", e)
+		}
+
+		e, _ = cp.Explain("memos", 'u', "alice", []byte("a"))
+		if !e.Allowed || e.EffectiveRoles != "aev" || e.AllowedRoles != "ea" {
+			t.Errorf("unexpected explanation: %+v", e)
+		}
+
+		if _, err := cp.Explain("nope", 'r', "", nil); err == nil {
+			t.Error("expected error for an unknown handler")
+		}
+		if _, err := cp.Explain("memos", 'd', "", nil); err == nil {
+			t.Error("expected error for an action the handler does not implement")
+		}
+	})
+
+	t.Run("Policies", func(t *testing.T) {
+		cp, _ := newServer()
+		admins := crudp.PolicyFunc(func(req *crudp.AccessRequest) crudp.Verdict {
+			if req.Roles[0] == 'a' {
+				return crudp.Verdict{Decision: crudp.Allow, Reason: "admin"}
+			}
+			return crudp.Verdict{Decision: crudp.Abstain}
+		})
+		cp.SetAccessPolicies(crudp.FirstMatch, admins, crudp.RecordOwner(func(record any) string { return record.(*Memo).Owner }))
+
+		e, _ := cp.Explain("memos", 'u', "bob", []byte("e"), "2")
+		if e.Allowed || e.Check != "policies" || e.Reason != "record owned by another user" || len(e.Steps) != 2 {
+			t.Fatalf("unexpected explanation: %+v", e)
+		}
+		if e.Steps[0].Decision != "abstain" || e.Steps[1].Decision != "deny" || e.Steps[1].Policy != 1 {
+			t.Errorf("unexpected steps: %+v", e.Steps)
+		}
+
+		e, _ = cp.Explain("memos", 'u', "bob", []byte("e"), "1")
+		if !e.Allowed || e.Reason != "record owner" {
+			t.Errorf("owner should be allowed: %+v", e)
+		}
+	})
+
+	t.Run("Matrix", func(t *testing.T) {
+		cp, _ := newServer()
+		rows := cp.AccessMatrix(nil)
+		want := map[byte][2]string{'c': {"ae", "v"}, 'r': {"aev", ""}, 'u': {"ae", "v"}}
+		if len(rows) != len(want) {
+			t.Fatalf("expected %d rows, got %+v", len(want), rows)
+		}
+		for _, row := range rows {
+			if row.Handler != "memos" || row.Allowed != want[row.Action][0] || row.Denied != want[row.Action][1] {
+				t.Errorf("unexpected row: %+v", row)
+			}
+		}
+	})
+
+	t.Run("Endpoint", func(t *testing.T) {
+		_, mux := newServer()
+		get := func(path string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			return rec
+		}
+
+		roles = "e"
+		if rec := get("/_access/explain?handler=memos&action=c&roles=v"); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a non-admin, got %d", rec.Code)
+		}
+
+		roles = "a"
+		rec := get("/_access/explain?handler=memos&action=c&roles=v")
+		var e crudp.Explanation
+		if rec.Code != http.StatusOK || jsonDecode(rec.Body.Bytes(), &e) != nil || e.Allowed || e.Roles != "v" {
+			t.Errorf("unexpected explain response %d: %s", rec.Code, rec.Body.String())
+		}
+
+		rec = get("/_access/matrix?roles=v")
+		var rows []crudp.MatrixRow
+		if rec.Code != http.StatusOK || jsonDecode(rec.Body.Bytes(), &rows) != nil || len(rows) != 3 {
+			t.Errorf("unexpected matrix response %d: %s", rec.Code, rec.Body.String())
+		}
+
+		if rec := get("/_access/explain?handler=memos&action=cu"); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for an invalid action, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,18 @@
+//go:build wasm
+
+package crudp
+
+// Client internals exercised by the crudp_test package
+
+func (cp *CrudP) ApplyOptimistic(req *BatchRequest) { cp.applyOptimistic(req) }
+
+// FailPacket settles an optimistic packet whose batch never reached the server
+func (cp *CrudP) FailPacket(reqID string) {
+	if sent, ok := cp.takePending(reqID); ok {
+		cp.rollback(&sent, nil)
+	}
+}
+
+func (cp *CrudP) ServeCachedReads(req *BatchRequest) *BatchRequest { return cp.serveCachedReads(req) }
+
+func (cp *CrudP) UpdateCache(res *PacketResult) { cp.updateCache(res) }
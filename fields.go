@@ -0,0 +1,151 @@
+package crudp
+
+import (
+	"reflect"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// fieldPolicy limits who may read and write one exported struct field.
+// Declared with a tag such as `crudp:"read=ae,write=a"`: each character
+// after read= or write= is a role; an omitted key allows everyone.
+type fieldPolicy struct {
+	index int
+	name  string
+	read  []byte
+	write []byte
+}
+
+// parseFieldPolicies reads the crudp tags of the fields of t
+func parseFieldPolicies(t reflect.Type) ([]fieldPolicy, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	var policies []fieldPolicy
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("crudp")
+		if !ok {
+			continue
+		}
+		if !f.IsExported() {
+			return nil, errorf("crudp tag on unexported field %s.%s", t.Name(), f.Name)
+		}
+
+		p := fieldPolicy{index: i, name: f.Name}
+		for _, part := range Split(tag, ",") {
+			part = Convert(part).TrimSpace().String()
+			switch {
+			case HasPrefix(part, "read="):
+				p.read = []byte(part[len("read="):])
+			case HasPrefix(part, "write="):
+				p.write = []byte(part[len("write="):])
+			default:
+				return nil, errorf("invalid crudp tag %q on field %s.%s", part, t.Name(), f.Name)
+			}
+		}
+		// Security-by-default: an empty role list would silently lock the field
+		if (p.read != nil && len(p.read) == 0) || (p.write != nil && len(p.write) == 0) {
+			return nil, errorf("security error: empty roles in crudp tag on field %s.%s", t.Name(), f.Name)
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// stripFields returns result with the fields roles may not read zeroed.
+// Entities are copied; the handler's own values are never modified.
+func (h actionHandler) stripFields(roles []byte, result any) any {
+	var hidden []int
+	for _, f := range h.fields {
+		if f.read != nil && !hasAnyRole(roles, f.read) {
+			hidden = append(hidden, f.index)
+		}
+	}
+	if len(hidden) == 0 || result == nil {
+		return result
+	}
+	return stripValue(reflect.ValueOf(result), h.dataType, hidden).Interface()
+}
+
+func stripValue(v reflect.Value, t reflect.Type, hidden []int) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Elem().Type() != t {
+			return v
+		}
+		c := reflect.New(t)
+		c.Elem().Set(v.Elem())
+		zeroFields(c.Elem(), hidden)
+		return c
+	case reflect.Struct:
+		if v.Type() != t {
+			return v
+		}
+		c := reflect.New(t).Elem()
+		c.Set(v)
+		zeroFields(c, hidden)
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		return stripValue(v.Elem(), t, hidden)
+	case reflect.Slice:
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(stripValue(v.Index(i), t, hidden))
+		}
+		return out
+	}
+	return v
+}
+
+func zeroFields(v reflect.Value, fields []int) {
+	for _, i := range fields {
+		f := v.Field(i)
+		f.Set(reflect.Zero(f.Type()))
+	}
+}
+
+// checkFieldWrites rejects payloads setting fields roles may not write. On
+// updates, protected fields left zero keep their stored value, so clients
+// can send back entities whose hidden fields were stripped.
+func (h actionHandler) checkFieldWrites(roles []byte, payload, stored any) error {
+	if len(h.fields) == 0 {
+		return nil
+	}
+	v := reflect.ValueOf(payload)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Type() != h.dataType {
+		return nil
+	}
+	entity := v.Elem()
+
+	var current reflect.Value
+	if s := reflect.ValueOf(stored); s.Kind() == reflect.Ptr && !s.IsNil() && s.Elem().Type() == h.dataType {
+		current = s.Elem()
+	}
+
+	for _, f := range h.fields {
+		canRead := f.read == nil || hasAnyRole(roles, f.read)
+		canWrite := f.write == nil || hasAnyRole(roles, f.write)
+		if canRead && canWrite {
+			continue
+		}
+
+		field := entity.Field(f.index)
+		if current.IsValid() && field.IsZero() {
+			field.Set(current.Field(f.index))
+			continue
+		}
+		if canWrite || field.IsZero() {
+			continue
+		}
+		if current.IsValid() && reflect.DeepEqual(field.Interface(), current.Field(f.index).Interface()) {
+			continue
+		}
+		return &StatusError{Code: 403, Message: "field " + f.name + " may not be set"}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+type Employee struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Salary int    `json:"salary" crudp:"read=a,write=a"`
+	Role   string `json:"role" crudp:"write=a"`
+}
+
+var employeeStore map[string]*Employee
+
+func (e *Employee) HandlerName() string { return "employees" }
+func (e *Employee) Read(id string) (any, error) {
+	if stored, ok := employeeStore[id]; ok {
+		return stored, nil
+	}
+	return nil, &crudp.StatusError{Code: 404, Message: "not found"}
+}
+func (e *Employee) List() (any, error) { return []*Employee{employeeStore["1"]}, nil }
+func (e *Employee) Create(payload any) (any, error) {
+	emp := payload.(*Employee)
+	employeeStore[emp.ID] = emp
+	return emp, nil
+}
+func (e *Employee) Update(payload any) (any, error) {
+	emp := payload.(*Employee)
+	employeeStore[emp.ID] = emp
+	return emp, nil
+}
+func (e *Employee) ValidateData(byte, any) error    { return nil }
+func (e *Employee) AllowedRoles(action byte) []byte { return []byte{'*'} }
+
+type BadTag struct {
+	Secret string `crudp:"read="`
+}
+
+func (b *BadTag) HandlerName() string             { return "bad" }
+func (b *BadTag) Read(id string) (any, error)     { return nil, nil }
+func (b *BadTag) List() (any, error)              { return nil, nil }
+func (b *BadTag) ValidateData(byte, any) error    { return nil }
+func (b *BadTag) AllowedRoles(action byte) []byte { return []byte{'*'} }
+
+func TestFieldPolicies(t *testing.T) {
+	roles := "v"
+	setup := func(t *testing.T) *http.ServeMux {
+		employeeStore = map[string]*Employee{"1": {ID: "1", Name: "Ann", Salary: 5000, Role: "staff"}}
+		cp := NewTestCrudP()
+		cp.SetDevMode(false)
+		cp.SetUserRoles(func(data ...any) []byte { return []byte(roles) })
+		if err := cp.RegisterHandlers(&Employee{}); err != nil {
+			t.Fatalf("RegisterHandlers failed: %v", err)
+		}
+		mux := http.NewServeMux()
+		cp.RegisterRoutes(mux)
+		return mux
+	}
+	do := func(mux *http.ServeMux, method, path string, emp *Employee) (int, *Employee) {
+		var body []byte
+		if emp != nil {
+			var data []byte
+			jsonEncode(emp, &data)
+			jsonEncode(crudp.Request{Data: [][]byte{data}}, &body)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, bytes.NewReader(body)))
+		var resp crudp.Response
+		jsonDecode(rec.Body.Bytes(), &resp)
+		var out Employee
+		if len(resp.Data) > 0 {
+			jsonDecode(resp.Data[0], &out)
+		}
+		return rec.Code, &out
+	}
+
+	t.Run("Hidden Fields Are Stripped", func(t *testing.T) {
+		roles = "v"
+		mux := setup(t)
+		if _, emp := do(mux, "GET", "/employees/1", nil); emp.Name != "Ann" || emp.Salary != 0 {
+			t.Errorf("expected salary hidden from visitors, got %+v", emp)
+		}
+		if _, emp := do(mux, "GET", "/employees/", nil); emp.Salary != 0 {
+			t.Errorf("expected salary hidden in lists, got %+v", emp)
+		}
+		if employeeStore["1"].Salary != 5000 {
+			t.Error("stripping must not modify the stored entity")
+		}
+
+		roles = "a"
+		if _, emp := do(mux, "GET", "/employees/1", nil); emp.Salary != 5000 {
+			t.Errorf("expected salary visible to admins, got %+v", emp)
+		}
+	})
+
+	t.Run("Protected Fields Are Rejected Or Kept", func(t *testing.T) {
+		roles = "e"
+		mux := setup(t)
+		if code, _ := do(mux, "PUT", "/employees/1", &Employee{ID: "1", Name: "Ann", Role: "admin"}); code != http.StatusForbidden {
+			t.Errorf("expected 403 when changing role, got %d", code)
+		}
+		if code, _ := do(mux, "POST", "/employees/", &Employee{ID: "2", Salary: 9000}); code != http.StatusForbidden {
+			t.Errorf("expected 403 when creating with a salary, got %d", code)
+		}
+
+		// A stripped entity sent back keeps its protected values
+		code, emp := do(mux, "PUT", "/employees/1", &Employee{ID: "1", Name: "Anne", Role: "staff"})
+		if code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+		if stored := employeeStore["1"]; stored.Name != "Anne" || stored.Salary != 5000 || stored.Role != "staff" {
+			t.Errorf("unexpected stored entity: %+v", stored)
+		}
+		if emp.Salary != 0 {
+			t.Errorf("update result must be stripped too, got %+v", emp)
+		}
+	})
+
+	t.Run("Preconditions Match The Stripped Tag", func(t *testing.T) {
+		roles = "e"
+		mux := setup(t)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/employees/1", nil))
+		tag := rec.Header().Get("ETag")
+		if tag == "" {
+			t.Fatal("expected an ETag on the read")
+		}
+
+		var data, body []byte
+		jsonEncode(&Employee{ID: "1", Name: "Anne", Role: "staff"}, &data)
+		jsonEncode(crudp.Request{Data: [][]byte{data}}, &body)
+		req := httptest.NewRequest("PUT", "/employees/1", bytes.NewReader(body))
+		req.Header.Set("If-Match", tag)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("If-Match with the read ETag: expected 200, got %d", rec.Code)
+		}
+
+		// Packet.Version goes through the same check
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/employees/1", nil))
+		jsonEncode(&Employee{ID: "1", Name: "Annie", Role: "staff"}, &data)
+		jsonEncode(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'u', ReqID: "u1", Version: rec.Header().Get("ETag"), Data: [][]byte{data}}}}, &body)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("POST", "/batch", bytes.NewReader(body)))
+		var resp crudp.BatchResponse
+		if jsonDecode(rec.Body.Bytes(), &resp); len(resp.Results) != 1 || resp.Results[0].Status != 0 {
+			t.Errorf("Packet.Version with the read ETag: expected success, got %+v", resp.Results)
+		}
+		if stored := employeeStore["1"]; stored.Name != "Annie" || stored.Salary != 5000 {
+			t.Errorf("unexpected stored entity: %+v", stored)
+		}
+	})
+
+	t.Run("Conflicts And Changes Are Stripped", func(t *testing.T) {
+		roles = "e"
+		employeeStore = map[string]*Employee{"1": {ID: "1", Name: "Ann", Salary: 5000, Role: "staff"}}
+		cp := NewTestCrudP()
+		cp.SetDevMode(false)
+		cp.SetUserRoles(func(data ...any) []byte { return []byte(roles) })
+		cp.SetChangeLog(crudp.NewMemoryChangeLog(10))
+		pusher := &fakePusher{pushed: map[string][]crudp.PacketResult{}}
+		cp.SetPusher(pusher, crudp.NewSSEPusher(cp).ConnID)
+		if err := cp.RegisterHandlers(&Employee{}); err != nil {
+			t.Fatalf("RegisterHandlers failed: %v", err)
+		}
+		mux := http.NewServeMux()
+		cp.RegisterRoutes(mux)
+
+		var data, body []byte
+		jsonEncode(&Employee{ID: "1", Name: "Anne", Role: "staff"}, &data)
+		jsonEncode(crudp.Request{Data: [][]byte{data}}, &body)
+		req := httptest.NewRequest("PUT", "/employees/1", bytes.NewReader(body))
+		req.Header.Set("If-Match", `"stale"`)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		var resp crudp.Response
+		jsonDecode(rec.Body.Bytes(), &resp)
+		var current Employee
+		if rec.Code != http.StatusPreconditionFailed || len(resp.Data) != 1 || jsonDecode(resp.Data[0], &current) != nil || current.Name != "Ann" || current.Salary != 0 {
+			t.Errorf("expected 412 with the stripped stored copy, got %d %+v", rec.Code, current)
+		}
+
+		cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: '+', ReqID: "s1"}}}, connRequest("e"))
+		roles = "a"
+		if _, err := cp.CallHandler(0, 'u', &Employee{ID: "1", Name: "Ann", Salary: 6000, Role: "staff"}); err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+		roles = "e"
+
+		salary := func(where string, data []byte) {
+			var emp Employee
+			if err := jsonDecode(data, &emp); err != nil || emp.Name != "Ann" || emp.Salary != 0 {
+				t.Errorf("expected salary hidden in the %s, got %+v (%v)", where, emp, err)
+			}
+		}
+		if pushed := pusher.pushed["e"]; len(pushed) != 1 {
+			t.Errorf("expected one push, got %+v", pushed)
+		} else {
+			salary("push", pushed[0].Data[0])
+		}
+
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/changes?since=0", nil))
+		var feed crudp.ChangeFeed
+		if jsonDecode(rec.Body.Bytes(), &feed); len(feed.Changes) != 1 {
+			t.Fatalf("expected one change, got %+v", feed)
+		}
+		salary("change feed", feed.Changes[0].Data)
+
+		synced, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 's', ReqID: "y1"}}})
+		if len(synced.Results) != 2 {
+			t.Fatalf("expected one synced entity, got %+v", synced.Results)
+		}
+		salary("sync", synced.Results[0].Data[0])
+	})
+
+	t.Run("Invalid Tag", func(t *testing.T) {
+		cp := NewTestCrudP()
+		cp.SetUserRoles(func(data ...any) []byte { return nil })
+		if err := cp.RegisterHandlers(&BadTag{}); err == nil {
+			t.Error("expected an error for a crudp tag with no roles")
+		}
+	})
+}
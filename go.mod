@@ -9,5 +9,3 @@ require (
 )
 
 require github.com/tinywasm/dom v0.10.1
-
-require github.com/tinywasm/json v0.5.2
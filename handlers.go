@@ -8,11 +8,15 @@ import (
 
 // RegisterHandlers prepares the shared handler table
 func (cp *CrudP) RegisterHandlers(handlers ...any) error {
+	if err := cp.checkRoleHierarchy(); err != nil {
+		return err
+	}
+
 	cp.handlers = make([]actionHandler, len(handlers))
 
 	for i, h := range handlers {
 		if h == nil {
-			return Errf("handler %d is nil", i)
+			return errorf("handler %d is nil", i)
 		}
 
 		ah := actionHandler{
@@ -21,29 +25,25 @@ func (cp *CrudP) RegisterHandlers(handlers ...any) error {
 		}
 
 		// Bind CRUD methods and track if any are implemented
-		hasCRUD := false
-		if creator, ok := h.(Creator); ok {
-			ah.Create = creator.Create
-			hasCRUD = true
-		}
-		if reader, ok := h.(Reader); ok {
-			ah.Read = reader.Read
-			hasCRUD = true
+		hasCRUD := ah.bind(h)
+		if tenants, ok := h.(TenantHandler); ok {
+			ah.forTenant = tenants.ForTenant
 		}
-		if updater, ok := h.(Updater); ok {
-			ah.Update = updater.Update
-			hasCRUD = true
+		_, ah.tenantOwned = h.(TenantOwned)
+		ah.tenantScoped = ah.tenantOwned || ah.forTenant != nil
+		if records, ok := h.(RecordAccess); ok {
+			ah.AllowRecord = records.AllowRecord
 		}
-		if deleter, ok := h.(Deleter); ok {
-			ah.Delete = deleter.Delete
-			hasCRUD = true
+		// Results of RecordAccess and tenant handlers depend on the caller, not only on roles
+		if cacheable, ok := h.(Cacheable); ok && ah.Read != nil && ah.AllowRecord == nil && !ah.tenantScoped {
+			ah.cacheReads = cacheable.CacheReads()
 		}
 
 		if hasCRUD {
 			// Enforce NamedHandler
 			named, ok := h.(NamedHandler)
 			if !ok {
-				return Errf("missing interface: 'HandlerName() string' for handler at index %d", i)
+				return errorf("missing interface: 'HandlerName() string' for handler at index %d", i)
 			}
 			ah.name = named.HandlerName()
 
@@ -51,10 +51,10 @@ func (cp *CrudP) RegisterHandlers(handlers ...any) error {
 			if validator, ok := h.(DataValidator); ok {
 				ah.ValidateData = validator.ValidateData
 			} else {
-				return Errf("missing interface: 'ValidateData(action byte, payload any) error' for handler: %s", ah.name)
+				return errorf("missing interface: 'ValidateData(action byte, payload any) error' for handler: %s", ah.name)
 			}
 
-			// Enforce AccessLevel (optional when SetAccessCheck is configured)
+			// Enforce AccessLevel (optional when SetAccessCheck or SetAccessPolicies is configured)
 			if access, ok := h.(AccessLevel); ok {
 				ah.AllowedRoles = access.AllowedRoles
 
@@ -63,28 +63,16 @@ func (cp *CrudP) RegisterHandlers(handlers ...any) error {
 				if cp.accessCheckFn == nil {
 					for _, action := range []byte{'c', 'r', 'u', 'd'} {
 						// Only validate actions that are implemented
-						implemented := false
-						switch action {
-						case 'c':
-							implemented = ah.Create != nil
-						case 'r':
-							implemented = ah.Read != nil
-						case 'u':
-							implemented = ah.Update != nil
-						case 'd':
-							implemented = ah.Delete != nil
-						}
-
-						if implemented {
+						if ah.implements(action) {
 							roles := ah.AllowedRoles(action)
 							if len(roles) == 0 {
-								return Errf("security error: AllowedRoles('%c') returned nil/empty for handler: %s (each action must define at least one role)", action, ah.name)
+								return errorf("security error: AllowedRoles('%c') returned nil/empty for handler: %s (each action must define at least one role)", action, ah.name)
 							}
 						}
 					}
 				}
-			} else if cp.accessCheckFn == nil {
-				return Errf("missing interface: 'AllowedRoles(action byte) []byte' for handler: %s", ah.name)
+			} else if cp.accessCheckFn == nil && cp.policies == nil {
+				return errorf("missing interface: 'AllowedRoles(action byte) []byte' for handler: %s", ah.name)
 			}
 
 			// Validate AllowedAccess doesn't return -1 or invalid for implemented actions
@@ -99,6 +87,16 @@ func (cp *CrudP) RegisterHandlers(handlers ...any) error {
 				t = t.Elem()
 			}
 			ah.dataType = t
+
+			fields, err := parseFieldPolicies(t)
+			if err != nil {
+				return err
+			}
+			ah.fields = fields
+		}
+
+		if ah.cacheReads && cp.cache == nil {
+			cp.cache = NewLRUCache(0, 0)
 		}
 
 		cp.handlers[i] = ah
@@ -109,7 +107,7 @@ func (cp *CrudP) RegisterHandlers(handlers ...any) error {
 
 	// Security: If CRUD handlers are registered but no access control is configured,
 	// and we are NOT in dev mode, it's a security risk.
-	if !cp.devMode && cp.getUserRoles == nil && cp.accessCheckFn == nil {
+	if !cp.devMode && cp.getUserRoles == nil && cp.accessCheckFn == nil && cp.policies == nil {
 		hasCRUD := false
 		for _, ah := range cp.handlers {
 			if ah.AllowedRoles != nil {
@@ -125,6 +123,35 @@ func (cp *CrudP) RegisterHandlers(handlers ...any) error {
 	return nil
 }
 
+// bind sets the CRUD methods implemented by h and reports if there are any
+func (ah *actionHandler) bind(h any) bool {
+	hasCRUD := false
+	if creator, ok := h.(Creator); ok {
+		ah.Create = creator.Create
+		hasCRUD = true
+	}
+	if reader, ok := h.(Reader); ok {
+		ah.Read = reader.Read
+		ah.List = reader.List
+		hasCRUD = true
+		if streamer, ok := h.(StreamLister); ok {
+			ah.StreamList = streamer.StreamList
+		}
+	}
+	if updater, ok := h.(Updater); ok {
+		ah.Update = updater.Update
+		hasCRUD = true
+	}
+	if deleter, ok := h.(Deleter); ok {
+		ah.Delete = deleter.Delete
+		hasCRUD = true
+	}
+	if rollbacker, ok := h.(Rollbacker); ok {
+		ah.Rollback = rollbacker.Rollback
+	}
+	return hasCRUD
+}
+
 // GetHandlerName returns the handler name by its ID
 func (cp *CrudP) GetHandlerName(handlerID uint8) string {
 	if int(handlerID) >= len(cp.handlers) {
@@ -136,52 +163,213 @@ func (cp *CrudP) GetHandlerName(handlerID uint8) string {
 // CallHandler searches and calls the handler directly by shared index
 func (cp *CrudP) CallHandler(handlerID uint8, action byte, data ...any) (any, error) {
 	if int(handlerID) >= len(cp.handlers) {
-		return nil, Errf("no handler found for id: %d", handlerID)
+		return nil, errorf("no handler found for id: %d", handlerID)
+	}
+	if cp.auditSink == nil {
+		return cp.call(cp.handlers[handlerID], action, nil, data...)
 	}
 
-	handler := cp.handlers[handlerID]
+	entry := cp.newAuditEntry(cp.handlers[handlerID], action, data...)
+	result, err := cp.call(cp.handlers[handlerID], action, entry, data...)
+	cp.audit(entry, result, err)
+	return result, err
+}
+
+// call runs the CallHandler pipeline. entry is filled for the audit log
+// when not nil.
+func (cp *CrudP) call(handler actionHandler, action byte, entry *AuditEntry, data ...any) (any, error) {
+	// 1. Rate limit
+	if err := cp.checkRateLimit(handler, action, data...); err != nil {
+		entry.deny()
+		return nil, err
+	}
+
+	// Tenant: scoped handlers require one and may be bound to it
+	tenant := cp.tenantOf(data...)
+	if handler.tenantScoped && cp.getTenant != nil {
+		err := cp.authorizeTenant(tenant, data...)
+		if err == nil {
+			handler, err = handler.withTenant(tenant)
+		}
+		if err != nil {
+			entry.deny()
+			return nil, err
+		}
+	}
 
-	// 1. Access Control
+	// 2. Extract payload and injected values
+	id, payload := callArgs(data)
+	// Update writes the id of the payload: checks must not target another one
+	if written := idOf(payload); action == 'u' && id != "" && written != "" && written != id {
+		return nil, &StatusError{Code: 400, Message: "id in path and payload differ"}
+	}
+	// The stored entity is read once, for the policies, version checks and audit
+	var stored *storedEntity
+	if action == 'u' || action == 'd' {
+		stored = &storedEntity{read: handler.Read, id: entityID(id, payload, nil)}
+		data = append(data[:len(data):len(data)], stored)
+		// The stored version must not change between its check and the write
+		if stored.id != "" && versionChecked(payload, data) {
+			defer cp.writeLocks.lock(handler.name + "|" + tenant + "|" + stored.id)()
+		}
+	}
+
+	// 3. Access control
 	if err := cp.accessCheck(handler, action, data...); err != nil {
+		entry.deny()
 		return nil, err
 	}
 
-	// 2. Extract payload (first element that is not *http.Request and not context.Context)
-	var payload any
-	var id string
+	var expected ifMatch
+	var outcome *resolution
+	codec := cp.codecFrom(nil)
+	for _, d := range data {
+		switch v := d.(type) {
+		case ifMatch:
+			expected = v
+		case *resolution:
+			outcome = v
+		case activeCodec:
+			codec = v
+		}
+	}
+
+	// 4. Record and field policies (read results are filtered after execution)
+	policy := cp.policyFor(handler, tenant, data...)
+	if policy != nil && action != 'r' {
+		if err := policy.before(action, id, payload, stored); err != nil {
+			entry.deny()
+			return nil, err
+		}
+	}
+
+	// 5. Validate
+	if handler.ValidateData != nil {
+		if err := handler.ValidateData(action, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	// 6. Concurrency: If-Match / Packet.Version, or the version of a Versioned payload
+	if action == 'u' || action == 'd' {
+		if expected != "" {
+			if err := cp.checkPrecondition(stored, expected, codec.out, policy); err != nil {
+				return nil, policy.conflict(err)
+			}
+		} else if v, ok := payload.(Versioned); ok {
+			if err := cp.checkVersion(stored, v); err != nil {
+				conflict, isConflict := err.(*ConflictError)
+				if !isConflict || action != 'u' {
+					return nil, policy.conflict(err)
+				}
+				resolved, result, keep, err := cp.resolveConflict(handler, payload, conflict)
+				if err != nil {
+					return nil, err
+				}
+				if outcome != nil {
+					outcome.outcome = result
+				}
+				if keep {
+					if policy != nil {
+						return policy.after(action, id, conflict.Current)
+					}
+					return conflict.Current, nil
+				}
+				payload = resolved
+				if handler.ValidateData != nil {
+					if err := handler.ValidateData(action, payload); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	// 7. Execute
+	if entry != nil {
+		cp.auditBefore(entry, id, payload, stored)
+	}
+	// Tombstones keep the deleted entity for the RecordAccess checks of readers
+	if action == 'd' && (cp.changeLog != nil || cp.hasSubscriptions()) {
+		stored.load()
+	}
+	result, err := cp.dispatch(handler, action, id, payload, policy, data...)
+	if err != nil {
+		return nil, err
+	}
+
+	// 8. Post-mutation hooks
+	if action == 'c' || action == 'u' || action == 'd' {
+		cp.afterMutation(handler, action, id, payload, result, data...)
+	}
+
+	// The audit keeps the entity as stored, before fields are stripped
+	if entry != nil && (action == 'c' || action == 'u') {
+		entry.After = cp.mutationData(action, payload, result)
+	}
+	if policy != nil && result != nil {
+		if result, err = policy.after(action, id, result); err != nil {
+			entry.deny()
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// implements reports whether the handler has a method for action
+func (h actionHandler) implements(action byte) bool {
+	switch action {
+	case 'c':
+		return h.Create != nil
+	case 'r':
+		return h.Read != nil
+	case 'u':
+		return h.Update != nil
+	case 'd':
+		return h.Delete != nil
+	}
+	return false
+}
+
+// callArgs returns the id (a string) and the payload in data: the first
+// element that is not *http.Request, context.Context or injected by crudp
+func callArgs(data []any) (id string, payload any) {
 	for _, d := range data {
 		switch v := d.(type) {
 		case string:
 			id = v
+		case ifMatch, *resolution, activeCodec, streamSink, *rateNotice, *storedEntity:
+			// consumed by CallHandler, dispatch and checkRateLimit
 		default:
 			// Ensure we don't pick up injected *http.Request or context.Context
-			typeStr := Sprintf("%T", v)
+			typeStr := reflect.TypeOf(v).String()
 			if typeStr != "*http.Request" && typeStr != "*context.Context" && typeStr != "*context.valueCtx" && typeStr != "*context.cancelCtx" && typeStr != "*context.timerCtx" && typeStr != "*context.emptyCtx" && payload == nil {
 				payload = v
 			}
 		}
 	}
+	return id, payload
+}
 
-	// 3. Validate
-	if handler.ValidateData != nil {
-		if err := handler.ValidateData(action, payload); err != nil {
-			return nil, err
-		}
-	}
-
-	// 4. Execute
+// dispatch runs the handler method bound to the action
+func (cp *CrudP) dispatch(handler actionHandler, action byte, id string, payload any, policy *callPolicy, data ...any) (any, error) {
 	switch action {
 	case 'c':
 		if handler.Create != nil {
 			return handler.Create(payload)
 		}
 	case 'r':
-		if id == "" && handler.List != nil {
-			return handler.List()
+		if sink := sinkFrom(data); sink != nil && id == "" && handler.StreamList != nil {
+			if policy != nil {
+				sink = policy.sink(sink)
+			}
+			return nil, handler.StreamList(sink)
 		}
-		if id != "" && handler.Read != nil {
-			return handler.Read(id)
+		// Server only: client replays of 'r' results must reach the handler
+		if handler.cacheReads && cp.cache != nil && cp.policyChecks {
+			return cp.cachedRead(handler, id, policy, data...)
 		}
+		return handler.read(id)
 	case 'u':
 		if handler.Update != nil {
 			return handler.Update(payload)
@@ -192,13 +380,46 @@ func (cp *CrudP) CallHandler(handlerID uint8, action byte, data ...any) (any, er
 			return nil, err
 		}
 	}
-	return nil, Errf("action '%c' not implemented for handler: %s", action, handler.name)
+	return nil, errorf("action '%c' not implemented for handler: %s", action, handler.name)
+}
+
+// read returns a single entity when id is set, all entities otherwise
+func (h actionHandler) read(id string) (any, error) {
+	if id == "" && h.List != nil {
+		return h.List()
+	}
+	if id != "" && h.Read != nil {
+		return h.Read(id)
+	}
+	return nil, errorf("action 'r' not implemented for handler: %s", h.name)
+}
+
+// afterMutation runs after a successful create, update or delete
+func (cp *CrudP) afterMutation(handler actionHandler, action byte, id string, payload, result any, data ...any) {
+	if cp.cache != nil && handler.cacheReads {
+		cp.cache.DeletePrefix(handler.name + "|")
+	}
+	if cp.changeLog == nil && !cp.hasSubscriptions() {
+		return
+	}
+
+	entity := entityID(id, payload, result)
+	encoded := cp.mutationData(action, payload, result)
+	if deleted, err := storedFrom(data).load(); action == 'd' && err == nil && deleted != nil {
+		encoded = cp.mutationData('u', nil, deleted)
+	}
+
+	// Listeners and subscribers see changes in the order of the log
+	cp.changeMu.Lock()
+	defer cp.changeMu.Unlock()
+	cp.recordChange(handler, action, entity, encoded, data...)
+	cp.publish(handler, action, entity, cp.changeTenant(handler, data...), encoded)
 }
 
-// decodeWithKnownType decodes packet data using cached type information
-func (cp *CrudP) decodeWithKnownType(p *Packet, handlerID uint8) ([]any, error) {
+// decodeWithKnownType decodes packet data with codec c using cached type information
+func (cp *CrudP) decodeWithKnownType(p *Packet, handlerID uint8, c Codec) ([]any, error) {
 	if int(handlerID) >= len(cp.handlers) {
-		return nil, Errf("no handler found for id: %d", handlerID)
+		return nil, errorf("no handler found for id: %d", handlerID)
 	}
 
 	handler := cp.handlers[handlerID]
@@ -206,16 +427,21 @@ func (cp *CrudP) decodeWithKnownType(p *Packet, handlerID uint8) ([]any, error)
 		return cp.decodeWithRawBytes(p)
 	}
 
+	// Deletes carry raw entity ids, not entities (docs/PACKET_STRUCTURE.md#delete-packets)
+	if p.Action == 'd' {
+		return decodeIDs(p)
+	}
+
 	decodedData := make([]any, 0, len(p.Data))
 	for _, itemBytes := range p.Data {
 		// New instance for each item using CACHED type
 		targetPtr := reflect.New(handler.dataType).Interface()
 
-		if cp.decode == nil {
+		if c.Decode == nil {
 			return nil, Errf("decode function not configured")
 		}
 
-		if err := cp.decode(itemBytes, targetPtr); err != nil {
+		if err := c.Decode(itemBytes, targetPtr); err != nil {
 			return nil, err
 		}
 
@@ -233,3 +459,36 @@ func (cp *CrudP) decodeWithRawBytes(p *Packet) ([]any, error) {
 	}
 	return decodedData, nil
 }
+
+// decodeIDs returns the id of a delete packet. A packet deletes one entity:
+// the handler only receives the last id, and the packet has one result.
+func decodeIDs(p *Packet) ([]any, error) {
+	if len(p.Data) > 1 {
+		return nil, &StatusError{Code: 400, Message: "delete packets carry one id"}
+	}
+	ids := make([]any, 0, len(p.Data))
+	for _, itemBytes := range p.Data {
+		ids = append(ids, string(itemBytes))
+	}
+	return ids, nil
+}
+
+// hasAnyRole checks if user has at least one of the allowed roles (OR logic)
+// Special case: '*' means any authenticated user (any non-empty userRoles)
+func hasAnyRole(userRoles, allowedRoles []byte) bool {
+	if len(allowedRoles) == 0 {
+		return false // Security-by-default (already checked in registration, but just in case)
+	}
+
+	for _, allowed := range allowedRoles {
+		if allowed == '*' && len(userRoles) > 0 {
+			return true
+		}
+		for _, user := range userRoles {
+			if allowed == user {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -3,7 +3,6 @@
 package crudp
 
 import (
-	"io"
 	"net/http"
 
 	"github.com/tinywasm/context"
@@ -20,10 +19,22 @@ func (cp *CrudP) RegisterRoutes(mux *http.ServeMux) {
 	cp.accessCheck = func(h actionHandler, a byte, d ...any) error {
 		return cp.doAccessCheck(h, a, d...)
 	}
+	cp.policyChecks = true
 
 	// 1. Register global batch endpoint
 	mux.HandleFunc("POST /batch", cp.handleBatch)
 
+	// Change feed endpoint (only when a ChangeLog is configured)
+	if cp.changeLog != nil {
+		mux.HandleFunc("GET /changes", cp.handleChanges)
+	}
+
+	// Access explain endpoints (only when SetExplainAccess is configured)
+	if cp.explainRoles != nil {
+		mux.HandleFunc("GET "+ExplainRoute+"/explain", cp.handleExplain)
+		mux.HandleFunc("GET "+ExplainRoute+"/matrix", cp.handleMatrix)
+	}
+
 	// 2. Generate automatic routes for each handler
 	for _, h := range cp.handlers {
 
@@ -42,13 +53,17 @@ func (cp *CrudP) RegisterRoutes(mux *http.ServeMux) {
 	}
 }
 
-// ApplyMiddleware collects all middleware from handlers and wraps the provided handler
+// ApplyMiddleware collects all middleware from handlers and wraps the provided handler.
+// With SetCSRF, every response also issues the CSRF token cookie.
 func (cp *CrudP) ApplyMiddleware(handler http.Handler) http.Handler {
 	for _, h := range cp.handlers {
 		if mwProvider, ok := h.handler.(MiddlewareProvider); ok {
 			handler = mwProvider.Middleware(handler)
 		}
 	}
+	if cp.csrf != nil {
+		handler = cp.csrfMiddleware(handler)
+	}
 	return handler
 }
 
@@ -58,46 +73,129 @@ func (cp *CrudP) handleBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	ctx, ok := cp.requestContext(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := cp.readBody(r)
 	if err != nil {
-		http.Error(w, "Error reading body", http.StatusBadRequest)
+		http.Error(w, err.Error(), int(statusOf(err)))
 		return
 	}
 
-	var req BatchRequest
-	if cp.decode == nil {
-		http.Error(w, "decode function not configured", http.StatusInternalServerError)
+	// Content negotiation: decoder from Content-Type, encoder from Accept.
+	// Streamed responses are written in the request's codec.
+	accept := r.Header.Get("Accept")
+	stream := acceptsStream(accept)
+	if stream {
+		accept = ""
+	}
+	n := cp.negotiate(r.Header.Get("Content-Type"), accept, true)
+	if n.status != 0 {
+		http.Error(w, http.StatusText(int(n.status)), int(n.status))
 		return
 	}
 
-	if err := cp.decode(body, &req); err != nil {
+	var req BatchRequest
+	if err := decodeEnvelope(n.codec.in, n.binaryIn, body, &req); err != nil {
 		// Create a minimal error response if decoding fails
 		http.Error(w, "Error decoding request", http.StatusBadRequest)
 		return
 	}
+	if err := cp.checkBatch(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if stream {
+		cp.handleStreamBatch(w, r, ctx, &req, n.codec)
+		return
+	}
 
 	// Inject context and http.Request for handlers
-	ctx := context.Background()
-	resp, err := cp.Execute(&req, ctx, r)
+	notice := &rateNotice{}
+	resp, err := cp.Execute(&req, ctx, r, n.codec, notice)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Rate limited packets: Retry-After, and 429 when none got through
+	status := 0
+	if notice.retryAfter > 0 {
+		w.Header().Set("Retry-After", Sprint(notice.retryAfter))
+		status = http.StatusTooManyRequests
+		for _, res := range resp.Results {
+			if res.Status != http.StatusTooManyRequests {
+				status = 0
+				break
+			}
+		}
+	}
+
+	encoded, err := encodeEnvelope(n.codec.out, n.binaryOut, resp)
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := n.codec.out.MIME
+	if n.binaryOut {
+		contentType = MIMEBinary
+	}
+	cp.writeBody(w, r, status, contentType, encoded)
+}
+
+// handleChanges serves GET /changes?since=<seq>&limit=<n>
+func (cp *CrudP) handleChanges(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := cp.requestContext(w, r)
+	if !ok {
+		return
+	}
+
+	var since uint64
+	var limit int64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := Convert(v).Uint64()
+		if err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+		since = n
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := Convert(v).Int64()
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	feed, err := cp.changesFor(since, int(limit), ctx, r)
+	if err != nil {
+		status := int(statusOf(err)) // 410 when since is older than the log
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
 	if cp.encode == nil {
 		http.Error(w, "encode function not configured", http.StatusInternalServerError)
 		return
 	}
 
-	var encoded []byte
-	if err := cp.encode(resp, &encoded); err != nil {
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	// Change data is stored in the default codec, so is the feed
+	encoded, err := cp.encodeBody(feed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// NOTE: Content-Type depends on codec, but defaulting to JSON is common
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(encoded)
+	cp.writeBody(w, r, 0, cp.defaultCodec().MIME, encoded)
 }
 
 func (cp *CrudP) makeHandler(h actionHandler, action byte) http.HandlerFunc {
@@ -108,49 +206,91 @@ func (cp *CrudP) makeHandler(h actionHandler, action byte) http.HandlerFunc {
 }
 
 func (cp *CrudP) handleSingle(w http.ResponseWriter, r *http.Request, h actionHandler, action byte, path string) {
-	body, err := io.ReadAll(r.Body)
+	ctx, ok := cp.requestContext(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := cp.readBody(r)
 	if err != nil {
-		http.Error(w, "Error reading body", http.StatusBadRequest)
+		http.Error(w, err.Error(), int(statusOf(err)))
+		return
+	}
+
+	accept := r.Header.Get("Accept")
+	stream := action == 'r' && path == "" && h.StreamList != nil && acceptsStream(accept)
+	if stream {
+		accept = ""
+	}
+	n := cp.negotiate(r.Header.Get("Content-Type"), accept, false)
+	if n.status != 0 {
+		http.Error(w, http.StatusText(int(n.status)), int(n.status))
 		return
 	}
+	codec := n.codec
 
 	var req Request
 	if len(body) > 0 {
-		if cp.decode == nil {
+		if codec.in.Decode == nil {
 			http.Error(w, "decode function not configured", http.StatusInternalServerError)
 			return
 		}
-		if err := cp.decode(body, &req); err != nil {
+		if err := codec.in.Decode(body, &req); err != nil {
 			http.Error(w, "Error decoding request", http.StatusBadRequest)
 			return
 		}
 	}
 
+	if stream {
+		cp.handleStreamSingle(w, r, ctx, h, codec.out, req.ReqID)
+		return
+	}
+
+	if err := cp.checkItems(req.Data); err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
 	// Prepare data for handler
-	decodedData, err := cp.decodeWithKnownType(&Packet{Data: req.Data}, h.index)
+	decodedData, err := cp.decodeWithKnownType(&Packet{Data: req.Data}, h.index, codec.in)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Prepend path (as string) and other injectables (context, request)
-	ctx := context.Background()
-	inject := []any{ctx, r}
+	inject := []any{ctx, r, codec}
 	if path != "" {
 		inject = append(inject, path)
 	}
-	allData := append(inject, decodedData...)
+	if tag := r.Header.Get("If-Match"); tag != "" && (action == 'u' || action == 'd') {
+		inject = append(inject, ifMatch(tag))
+	}
+	outcome := &resolution{}
+	notice := &rateNotice{}
+	allData := append(append(inject, decodedData...), outcome, notice)
 
 	// Call handler directly via CallHandler (which handles the error detection logic we added)
 	result, err := cp.CallHandler(h.index, action, allData...)
 
 	resp := Response{
-		ReqID: req.ReqID,
+		ReqID:      req.ReqID,
+		Resolution: outcome.outcome,
 	}
 
 	if err != nil {
-		resp.MessageType = uint8(Msg.Error)
-		resp.Message = err.Error()
+		pr := PacketResult{}
+		cp.setError(&pr, err, codec.out)
+		resp.MessageType = pr.MessageType
+		resp.Message = pr.Message
+		resp.Status = pr.Status
+		resp.Data = pr.Data
+		if pr.Version != "" {
+			w.Header().Set("ETag", pr.Version)
+		}
+		if notice.retryAfter > 0 {
+			w.Header().Set("Retry-After", Sprint(notice.retryAfter))
+		}
 	} else {
 		resp.MessageType = uint8(Msg.Success)
 		resp.Message = "OK"
@@ -158,27 +298,54 @@ func (cp *CrudP) handleSingle(w http.ResponseWriter, r *http.Request, h actionHa
 		// Encode results
 		if result != nil {
 			pr := PacketResult{}
-			if err := cp.encodeResult(&pr, result); err != nil {
+			if err := cp.encodeResult(&pr, result, codec.out); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 			resp.Data = pr.Data
-		}
-	}
 
-	if cp.encode == nil {
-		http.Error(w, "encode function not configured", http.StatusInternalServerError)
-		return
+			tag := tagOf(result, pr.Data)
+			if tag != "" {
+				w.Header().Set("ETag", tag)
+			}
+			if action == 'r' && matchTag(r.Header.Get("If-None-Match"), tag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
 	}
 
-	encoded, err := cp.encodeBody(resp)
+	encoded, err := encodeEnvelope(codec.out, false, resp)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(encoded)
+	cp.writeBody(w, r, int(resp.Status), codec.out.MIME, encoded)
+}
+
+// requestContext builds the context injected into the handler calls of r:
+// the authenticated identity (SetAuthenticator), then the tenant. Requests
+// failing the CSRF check are answered with 403, invalid credentials with
+// 401; ok is false then.
+func (cp *CrudP) requestContext(w http.ResponseWriter, r *http.Request) (ctx *context.Context, ok bool) {
+	if err := cp.checkCSRF(w, r); err != nil {
+		cp.log("csrf check failed:", r.Method, r.URL.Path, err)
+		http.Error(w, err.Error(), int(statusOf(err)))
+		return nil, false
+	}
+	ctx = context.Background()
+	if err := cp.authenticateRequest(ctx, r); err != nil {
+		cp.log("authentication failed:", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+	if cp.getTenant != nil {
+		if tenant := cp.getTenant(ctx, r); tenant != "" {
+			ctx.Set(TenantKey, tenant)
+		}
+	}
+	return ctx, true
 }
 
 func (cp *CrudP) encodeBody(data any) ([]byte, error) {
@@ -195,57 +362,31 @@ func (cp *CrudP) doAccessCheck(handler actionHandler, action byte, data ...any)
 		return nil
 	}
 
-	// External access check (e.g. rbac.HasPermission). Takes precedence over AllowedRoles.
-	if cp.accessCheckFn != nil {
-		if !cp.accessCheckFn(handler.name, action, data...) {
-			if cp.accessDeniedHandler != nil {
-				cp.accessDeniedHandler(handler.name, action, nil, nil, "access denied")
-			}
-			cp.log("access denied for handler:", handler.name)
-			return Errf("access denied")
-		}
-		return nil
-	}
-
-	// Static role-based check via AllowedRoles.
-	if handler.AllowedRoles == nil {
-		return nil
-	}
-
+	// The external check alone does not need the caller's identity
+	var userID string
 	var userRoles []byte
-	if cp.getUserRoles != nil {
-		userRoles = cp.getUserRoles(data...)
-	}
-
-	allowedRoles := handler.AllowedRoles(action)
-	if !hasAnyRole(userRoles, allowedRoles) {
-		errMsg := Sprintf("required roles %q, user has %q", allowedRoles, userRoles)
-		if cp.accessDeniedHandler != nil {
-			cp.accessDeniedHandler(handler.name, action, userRoles, allowedRoles, errMsg)
+	if cp.policies != nil || cp.accessCheckFn == nil {
+		if cp.getUserRoles != nil {
+			userRoles = cp.getUserRoles(data...)
+		}
+		if cp.policies != nil && cp.getUserID != nil {
+			userID = cp.getUserID(data...)
 		}
-		cp.log("access denied for handler:", handler.name)
-		return Errf("access denied")
 	}
 
-	return nil
-}
-
-// hasAnyRole checks if user has at least one of the allowed roles (OR logic)
-// Special case: '*' means any authenticated user (any non-empty userRoles)
-func hasAnyRole(userRoles, allowedRoles []byte) bool {
-	if len(allowedRoles) == 0 {
-		return false // Security-by-default (already checked in registration, but just in case)
+	e := cp.explain(handler, action, userID, userRoles, data...)
+	if e.Allowed {
+		return nil
 	}
 
-	for _, allowed := range allowedRoles {
-		if allowed == '*' && len(userRoles) > 0 {
-			return true
-		}
-		for _, user := range userRoles {
-			if allowed == user {
-				return true
-			}
+	errMsg := cp.withTenantNote(e.Reason, data...)
+	if cp.accessDeniedHandler != nil {
+		if e.Check == "external" {
+			cp.accessDeniedHandler(handler.name, action, nil, nil, errMsg)
+		} else {
+			cp.accessDeniedHandler(handler.name, action, roleBytes(e.EffectiveRoles), roleBytes(e.AllowedRoles), errMsg)
 		}
 	}
-	return false
+	cp.logDenied(handler.name, data...)
+	return cp.deniedError(data...)
 }
@@ -0,0 +1,108 @@
+package crudp
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Creates retried with the same IdempotencyKey are answered with the first
+// result for this long, for up to idempotencyCapacity keys
+const (
+	idempotencyTTLMs    = 24 * 60 * 60 * 1000
+	idempotencyCapacity = 10000
+)
+
+// idempotency remembers the results of creates by caller and IdempotencyKey
+type idempotency struct {
+	mu      sync.Mutex
+	entries map[string]*idempotentCall
+	order   []string // Keys of completed calls, oldest first
+}
+
+type idempotentCall struct {
+	done    chan struct{} // Closed when the first call completes
+	result  PacketResult
+	ok      bool  // The create succeeded and result is replayed
+	expires int64 // Unix milliseconds, 0 while in flight
+}
+
+// executeOnce runs a create carrying an IdempotencyKey. A retry of a create
+// that succeeded gets the stored result instead of creating the entity
+// again; a retry arriving while the first call runs waits for it. Failed
+// creates are not remembered.
+func (cp *CrudP) executeOnce(p *Packet, inject ...any) PacketResult {
+	key := cp.idempotencyKey(p, inject...)
+	for {
+		call, first := cp.idempotent.begin(key, time.Now().UnixMilli())
+		if first {
+			pr := cp.executeSingle(p, inject...)
+			cp.idempotent.finish(key, call, pr, time.Now().UnixMilli())
+			return pr
+		}
+		<-call.done
+		if call.ok {
+			pr := call.result
+			pr.ReqID = p.ReqID
+			return pr
+		}
+	}
+}
+
+// idempotencyKey scopes the client key to the handler and the caller, so
+// one caller cannot replay the result of another
+func (cp *CrudP) idempotencyKey(p *Packet, inject ...any) string {
+	var userID string
+	if cp.getUserID != nil {
+		userID = cp.getUserID(inject...)
+	}
+	handler := cp.GetHandlerName(p.HandlerID)
+	return handler + "|" + cp.tenantOf(inject...) + "|" + userID + "|" + p.IdempotencyKey
+}
+
+// begin returns the call stored for key, or registers a new one when first
+func (c *idempotency) begin(key string, now int64) (call *idempotentCall, first bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if call, ok := c.entries[key]; ok && (call.expires == 0 || call.expires > now) {
+		return call, false
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*idempotentCall)
+	}
+	c.evict(now)
+	call = &idempotentCall{done: make(chan struct{})}
+	c.entries[key] = call
+	return call, true
+}
+
+// finish stores the result of a successful create and releases waiters
+func (c *idempotency) finish(key string, call *idempotentCall, pr PacketResult, now int64) {
+	c.mu.Lock()
+	if pr.MessageType == uint8(Msg.Success) {
+		call.result, call.ok = pr, true
+		call.expires = now + idempotencyTTLMs
+		c.order = append(c.order, key)
+	} else {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// evict drops expired results, and the oldest ones beyond the capacity
+func (c *idempotency) evict(now int64) {
+	for len(c.order) > 0 {
+		key := c.order[0]
+		call, ok := c.entries[key]
+		if ok && call.expires != 0 && call.expires > now && len(c.entries) < idempotencyCapacity {
+			return
+		}
+		if ok && call.expires != 0 {
+			delete(c.entries, key)
+		}
+		c.order = c.order[1:]
+	}
+}
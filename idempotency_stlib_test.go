@@ -0,0 +1,72 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+// Ticket gets a new id on every create, so duplicates are visible
+type Ticket struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+var ticketStore []*Ticket
+
+func (t *Ticket) HandlerName() string { return "tickets" }
+func (t *Ticket) Create(payload any) (any, error) {
+	ticket := *payload.(*Ticket)
+	if ticket.Title == "" {
+		return nil, &crudp.StatusError{Code: 503, Message: "store unavailable"}
+	}
+	ticket.ID = strconv.Itoa(len(ticketStore) + 1)
+	ticketStore = append(ticketStore, &ticket)
+	return &ticket, nil
+}
+func (t *Ticket) ValidateData(byte, any) error    { return nil }
+func (t *Ticket) AllowedRoles(action byte) []byte { return []byte{'*'} }
+
+func TestIdempotentCreate(t *testing.T) {
+	ticketStore = nil
+	user := "alice"
+	cp := NewTestCrudP()
+	cp.SetUserID(func(data ...any) string { return user })
+	if err := cp.RegisterHandlers(&Ticket{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	create := func(reqID, key, title string) crudp.PacketResult {
+		var data []byte
+		jsonEncode(&Ticket{Title: title}, &data)
+		resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', ReqID: reqID, IdempotencyKey: key, Data: [][]byte{data}}}})
+		return resp.Results[0]
+	}
+
+	first := create("r1", "k1", "printer")
+	retry := create("r2", "k1", "printer")
+	if len(ticketStore) != 1 {
+		t.Fatalf("expected one ticket created, got %d", len(ticketStore))
+	}
+	if retry.Message != "OK" || retry.ReqID != "r2" || string(retry.Data[0]) != string(first.Data[0]) {
+		t.Errorf("expected the first result replayed for the retry, got %+v", retry)
+	}
+
+	create("r3", "k2", "printer")
+	create("r4", "", "printer")
+	user = "bob"
+	create("r5", "k1", "printer")
+	if len(ticketStore) != 4 {
+		t.Errorf("other keys, creates without a key and other callers must create, got %d tickets", len(ticketStore))
+	}
+
+	// Failed creates are not remembered
+	if res := create("r6", "k3", ""); res.Status != 503 {
+		t.Fatalf("expected the create to fail, got %+v", res)
+	}
+	if res := create("r7", "k3", "scanner"); res.Message != "OK" || len(ticketStore) != 5 {
+		t.Errorf("expected the retry of a failed create to run, got %+v", res)
+	}
+}
@@ -6,9 +6,9 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
-	tjson "github.com/tinywasm/json"
 	"github.com/tinywasm/crudp"
 )
 
@@ -81,7 +81,7 @@ func TestIntegration_AutomaticEndpoints(t *testing.T) {
 
 		// Decode response
 		var resp crudp.Response
-		if err := tjson.Decode(rec.Body.Bytes(), &resp); err != nil {
+		if err := jsonDecode(rec.Body.Bytes(), &resp); err != nil {
 			t.Fatalf("failed to decode response: %v", err)
 		}
 
@@ -104,7 +104,7 @@ func TestIntegration_AutomaticEndpoints(t *testing.T) {
 
 	t.Run("POST /batch", func(t *testing.T) {
 		var userData []byte
-		tjson.Encode(&IntegrationUser{Name: "Batch"}, &userData)
+		jsonEncode(&IntegrationUser{Name: "Batch"}, &userData)
 
 		batchReq := crudp.BatchRequest{
 			Packets: []crudp.Packet{
@@ -113,7 +113,7 @@ func TestIntegration_AutomaticEndpoints(t *testing.T) {
 		}
 
 		var body []byte
-		tjson.Encode(batchReq, &body)
+		jsonEncode(batchReq, &body)
 
 		req := httptest.NewRequest("POST", "/batch", httpBodyFromBytes(body))
 		rec := httptest.NewRecorder()
@@ -125,7 +125,7 @@ func TestIntegration_AutomaticEndpoints(t *testing.T) {
 		}
 
 		var resp crudp.BatchResponse
-		if err := tjson.Decode(rec.Body.Bytes(), &resp); err != nil {
+		if err := jsonDecode(rec.Body.Bytes(), &resp); err != nil {
 			t.Fatalf("failed to decode batch response: %v", err)
 		}
 
@@ -137,6 +137,42 @@ func TestIntegration_AutomaticEndpoints(t *testing.T) {
 			t.Errorf("expected success, got: %s", resp.Results[0].Message)
 		}
 	})
+
+	t.Run("POST /batch (binary envelope)", func(t *testing.T) {
+		var userData []byte
+		jsonEncode(&IntegrationUser{Name: "Binary"}, &userData)
+
+		var body []byte
+		crudp.EncodeBinary(&crudp.BatchRequest{Packets: []crudp.Packet{
+			{Action: 'c', HandlerID: 0, ReqID: "bin-1", Data: [][]byte{userData}},
+		}}, &body)
+
+		req := httptest.NewRequest("POST", "/batch", httpBodyFromBytes(body))
+		req.Header.Set("Content-Type", crudp.MIMEBinary)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if ct := rec.Header().Get("Content-Type"); ct != crudp.MIMEBinary {
+			t.Fatalf("expected binary response, got %q: %s", ct, rec.Body.String())
+		}
+		var resp crudp.BatchResponse
+		if err := crudp.DecodeBinary(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode binary response: %v", err)
+		}
+		if len(resp.Results) != 1 || resp.Results[0].ReqID != "bin-1" || resp.Results[0].MessageType != 4 {
+			t.Errorf("unexpected results: %+v", resp.Results)
+		}
+
+		// Accept selects the response envelope independently
+		req = httptest.NewRequest("POST", "/batch", httpBodyFromBytes(body))
+		req.Header.Set("Content-Type", crudp.MIMEBinary)
+		req.Header.Set("Accept", "application/json")
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if err := jsonDecode(rec.Body.Bytes(), &resp); err != nil {
+			t.Errorf("expected JSON response: %v", err)
+		}
+	})
 }
 
 type bytesBody struct {
@@ -230,7 +266,7 @@ func TestIntegration_AccessControl(t *testing.T) {
 		}
 
 		var resp crudp.Response
-		if err := tjson.Decode(rec.Body.Bytes(), &resp); err != nil {
+		if err := jsonDecode(rec.Body.Bytes(), &resp); err != nil {
 			t.Fatalf("failed to decode response: %v", err)
 		}
 
@@ -300,6 +336,57 @@ func TestIntegration_AccessControl(t *testing.T) {
 		}
 	})
 
+	t.Run("Role Hierarchy", func(t *testing.T) {
+		cp := NewTestCrudP()
+		cp.SetDevMode(false)
+		cp.SetRoleHierarchy(map[byte][]byte{'s': {'a'}, 'a': {'e'}, 'e': {'v'}})
+
+		roles := []byte{'s'}
+		cp.SetUserRoles(func(data ...any) []byte { return roles })
+		var denied []byte
+		cp.SetAccessDeniedHandler(func(handler string, action byte, userRoles []byte, allowedRoles []byte, errMsg string) {
+			denied = userRoles
+		})
+		if err := cp.RegisterHandlers(&RestrictedResource{}); err != nil { // Requires 'a'
+			t.Fatal(err)
+		}
+
+		mux := http.NewServeMux()
+		cp.RegisterRoutes(mux)
+
+		get := func() crudp.Response {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", "/restricted/", nil))
+			var resp crudp.Response
+			jsonDecode(rec.Body.Bytes(), &resp)
+			return resp
+		}
+
+		if resp := get(); resp.MessageType == 2 {
+			t.Errorf("'s' implies 'a' transitively, got %s", resp.Message)
+		}
+
+		roles = []byte{'e'}
+		if resp := get(); resp.MessageType != 2 {
+			t.Error("'e' must not inherit upwards")
+		}
+		if string(denied) != "ev" {
+			t.Errorf("expected effective roles \"ev\", got %q", denied)
+		}
+	})
+
+	t.Run("Role Hierarchy Cycle", func(t *testing.T) {
+		cp := NewTestCrudP()
+		cp.SetDevMode(false)
+		cp.SetUserRoles(func(data ...any) []byte { return nil })
+		cp.SetRoleHierarchy(map[byte][]byte{'a': {'e'}, 'e': {'v'}, 'v': {'a'}})
+
+		err := cp.RegisterHandlers(&RestrictedResource{})
+		if err == nil || !strings.Contains(err.Error(), "'a' -> 'e' -> 'v' -> 'a'") {
+			t.Errorf("expected cycle error, got %v", err)
+		}
+	})
+
 	t.Run("Special '*' Role Access", func(t *testing.T) {
 		cp := NewTestCrudP()
 		cp.SetDevMode(false)
@@ -332,7 +419,7 @@ func TestIntegration_AccessControl(t *testing.T) {
 		mux.ServeHTTP(rec, req)
 
 		var resp crudp.Response
-		tjson.Decode(rec.Body.Bytes(), &resp)
+		jsonDecode(rec.Body.Bytes(), &resp)
 		if resp.MessageType != 2 { // Msg.Error
 			t.Errorf("expected access denied for unauthenticated user on '*' resource")
 		}
@@ -43,3 +43,59 @@ type DataValidator interface {
 type AccessLevel interface {
 	AllowedRoles(action byte) []byte
 }
+
+// Rollbacker reverts a change applied optimistically on the client when the
+// server rejects it, or a create the server stored under another id.
+// payload is the data that was applied locally.
+type Rollbacker interface {
+	Rollback(action byte, payload any) error
+}
+
+// Cacheable opts a Reader into the server-side read-through cache.
+// Encoded results are cached per id and role set, and dropped whenever a
+// create, update or delete on the same handler succeeds.
+type Cacheable interface {
+	CacheReads() bool
+}
+
+// Versioned exposes the identity and version of an entity.
+// Version is used as ETag and for optimistic concurrency checks;
+// EntityID is the id passed to Reader.Read to load the stored copy.
+type Versioned interface {
+	EntityID() string
+	Version() string
+}
+
+// Timestamped exposes when an entity was last modified (Unix milliseconds).
+// Used by the LastWriterWins conflict resolver.
+type Timestamped interface {
+	UpdatedAt() int64
+}
+
+// StreamLister lists entities one at a time instead of returning them all
+// from List. yield returns false when the client went away or encoding
+// failed; StreamList should stop and return nil then.
+type StreamLister interface {
+	StreamList(yield func(item any) bool) error
+}
+
+// RecordAccess restricts actions to individual records. AllowRecord receives
+// the caller's id (SetUserID) and effective roles, the record id and the
+// record: the payload for 'c', the stored entity for 'u'/'d' (nil if it
+// cannot be read) and each read or listed entity for 'r'.
+type RecordAccess interface {
+	AllowRecord(action byte, userID string, roles []byte, id string, record any) bool
+}
+
+// TenantHandler serves several tenants. ForTenant returns the handler bound
+// to one tenant (e.g. to its database); its CRUD methods are used for calls
+// of that tenant. A nil return rejects the tenant.
+type TenantHandler interface {
+	ForTenant(tenant string) any
+}
+
+// TenantOwned is implemented by entities that belong to one tenant.
+// Payloads and results of another tenant are rejected or hidden.
+type TenantOwned interface {
+	TenantID() string
+}
@@ -0,0 +1,169 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// JWT authenticates HS256-signed bearer tokens (Authorization: Bearer <token>).
+type JWT struct {
+	Secret    []byte
+	UserClaim string          // Claim holding the user id, "sub" by default
+	RoleClaim string          // Claim holding role names, "roles" by default
+	RoleMap   map[string]byte // Role names to role bytes; nil uses one-character names as is
+	Issuer    string          // Required "iss" when set
+	Audience  string          // Required "aud" when set
+	Leeway    time.Duration   // Clock skew tolerated on "exp" and "nbf"
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Authenticate implements Authenticator
+func (j *JWT) Authenticate(r *http.Request) (*Identity, error) {
+	auth := r.Header.Get("Authorization")
+	if !HasPrefix(auth, "Bearer ") {
+		return nil, nil
+	}
+	claims, err := j.Verify(Convert(auth[len("Bearer "):]).TrimSpace().String())
+	if err != nil {
+		return nil, err
+	}
+
+	userClaim := j.UserClaim
+	if userClaim == "" {
+		userClaim = "sub"
+	}
+	userID, _ := claims[userClaim].(string)
+	if userID == "" {
+		return nil, Errf("invalid token: no user id")
+	}
+	return &Identity{UserID: userID, Roles: j.roles(claims)}, nil
+}
+
+// Sign issues a token for claims, e.g. {"sub": "42", "roles": []string{"admin"},
+// "exp": time.Now().Add(time.Hour).Unix()}
+func (j *JWT) Sign(claims map[string]any) (string, error) {
+	if len(j.Secret) == 0 {
+		return "", Errf("jwt secret not configured")
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(j.sign(unsigned)), nil
+}
+
+// Verify checks the signature, algorithm and time/issuer/audience claims of
+// token and returns its claims
+func (j *JWT) Verify(token string) (map[string]any, error) {
+	if len(j.Secret) == 0 {
+		return nil, Errf("jwt secret not configured")
+	}
+	parts := Split(token, ".")
+	if len(parts) != 3 {
+		return nil, Errf("invalid token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if raw, err := base64.RawURLEncoding.DecodeString(parts[0]); err != nil || json.Unmarshal(raw, &header) != nil {
+		return nil, Errf("invalid token header")
+	}
+	// Only HS256: rejects "none" and algorithm confusion
+	if header.Alg != "HS256" {
+		return nil, Errf("unsupported token algorithm")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, j.sign(parts[0]+"."+parts[1])) {
+		return nil, Errf("invalid token signature")
+	}
+
+	var claims map[string]any
+	if raw, err := base64.RawURLEncoding.DecodeString(parts[1]); err != nil || json.Unmarshal(raw, &claims) != nil {
+		return nil, Errf("invalid token claims")
+	}
+
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && now.Add(-j.Leeway).Unix() >= int64(exp) {
+		return nil, Errf("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(j.Leeway).Unix() < int64(nbf) {
+		return nil, Errf("token not valid yet")
+	}
+	if j.Issuer != "" && claims["iss"] != j.Issuer {
+		return nil, Errf("invalid token issuer")
+	}
+	if j.Audience != "" && !hasAudience(claims["aud"], j.Audience) {
+		return nil, Errf("invalid token audience")
+	}
+	return claims, nil
+}
+
+func (j *JWT) sign(unsigned string) []byte {
+	mac := hmac.New(sha256.New, j.Secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+// roles maps the role claim (a list of names or one space-separated string)
+// to role bytes; unknown names are ignored
+func (j *JWT) roles(claims map[string]any) []byte {
+	roleClaim := j.RoleClaim
+	if roleClaim == "" {
+		roleClaim = "roles"
+	}
+
+	var names []string
+	switch v := claims[roleClaim].(type) {
+	case string:
+		for _, name := range Split(v, " ") {
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if name, ok := item.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	var roles []byte
+	for _, name := range names {
+		if j.RoleMap != nil {
+			if role, ok := j.RoleMap[name]; ok {
+				roles = append(roles, role)
+			}
+		} else if len(name) == 1 {
+			roles = append(roles, name[0])
+		}
+	}
+	return roles
+}
+
+// hasAudience reports whether aud (a string or a list) contains want
+func hasAudience(aud any, want string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == want
+	case []any:
+		for _, item := range v {
+			if item == want {
+				return true
+			}
+		}
+	}
+	return false
+}
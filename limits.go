@@ -0,0 +1,43 @@
+package crudp
+
+import (
+	. "github.com/tinywasm/fmt"
+)
+
+// Limits caps the size of incoming requests. Zero values mean no limit.
+type Limits struct {
+	MaxBodyBytes int64 // HTTP request body, after decompression
+	MaxPackets   int   // Packets per BatchRequest
+	MaxItems     int   // Items per Packet.Data
+	MaxItemBytes int   // Bytes per Packet.Data item
+}
+
+// SetLimits configures request size limits. Oversize bodies and batches are
+// rejected with 413; packets with too many or too large items get a 413
+// error result while the rest of the batch is executed.
+func (cp *CrudP) SetLimits(l Limits) {
+	cp.limits = l
+}
+
+// checkBatch enforces MaxPackets
+func (cp *CrudP) checkBatch(req *BatchRequest) error {
+	if max := cp.limits.MaxPackets; max > 0 && len(req.Packets) > max {
+		return &StatusError{Code: 413, Message: Sprintf("batch has %d packets, limit is %d", len(req.Packets), max)}
+	}
+	return nil
+}
+
+// checkItems enforces MaxItems and MaxItemBytes before data is decoded
+func (cp *CrudP) checkItems(data [][]byte) error {
+	if max := cp.limits.MaxItems; max > 0 && len(data) > max {
+		return &StatusError{Code: 413, Message: Sprintf("packet has %d items, limit is %d", len(data), max)}
+	}
+	if max := cp.limits.MaxItemBytes; max > 0 {
+		for i, item := range data {
+			if len(item) > max {
+				return &StatusError{Code: 413, Message: Sprintf("item %d has %d bytes, limit is %d", i, len(item), max)}
+			}
+		}
+	}
+	return nil
+}
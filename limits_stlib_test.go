@@ -0,0 +1,101 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+func TestLimits(t *testing.T) {
+	batchBody := func(packets ...crudp.Packet) []byte {
+		var body []byte
+		jsonEncode(crudp.BatchRequest{Packets: packets}, &body)
+		return body
+	}
+	doc := func(id, txt string) []byte {
+		var data []byte
+		jsonEncode(&Doc{ID: id, Txt: txt}, &data)
+		return data
+	}
+
+	t.Run("Body Bytes", func(t *testing.T) {
+		cp, mux := newDocServer(t)
+		cp.SetLimits(crudp.Limits{MaxBodyBytes: 64})
+
+		body := batchBody(crudp.Packet{Action: 'c', ReqID: "c1", Data: [][]byte{doc("2", "a long enough text to exceed the limit")}})
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("POST", "/batch", httpBodyFromBytes(body)))
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413, got %d", rec.Code)
+		}
+		if _, ok := docStore["2"]; ok {
+			t.Error("oversize request must not be executed")
+		}
+	})
+
+	t.Run("Decompressed Body Bytes", func(t *testing.T) {
+		cp, mux := newDocServer(t)
+		cp.SetCompression(&crudp.Compression{})
+		cp.SetLimits(crudp.Limits{MaxBodyBytes: 1024})
+
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(make([]byte, 1<<20))
+		gz.Close()
+
+		req := httptest.NewRequest("POST", "/batch", httpBodyFromBytes(buf.Bytes()))
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413 for a compressed bomb, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Packets Per Batch", func(t *testing.T) {
+		cp, mux := newDocServer(t)
+		cp.SetLimits(crudp.Limits{MaxPackets: 2})
+
+		read := crudp.Packet{Action: 'r', ReqID: "r"}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("POST", "/batch", httpBodyFromBytes(batchBody(read, read, read))))
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413, got %d", rec.Code)
+		}
+
+		if _, err := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{read, read, read}}); err == nil {
+			t.Error("Execute must reject oversize batches")
+		}
+	})
+
+	t.Run("Items Per Packet", func(t *testing.T) {
+		cp, _ := newDocServer(t)
+		cp.SetLimits(crudp.Limits{MaxItems: 1, MaxItemBytes: 40})
+
+		resp, err := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{
+			{Action: 'c', ReqID: "many", Data: [][]byte{doc("2", ""), doc("3", "")}},
+			{Action: 'c', ReqID: "big", Data: [][]byte{doc("4", "a text that makes this item too large")}},
+			{Action: 'c', ReqID: "ok", Data: [][]byte{doc("5", "")}},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, reqID := range []string{"many", "big"} {
+			if res := resp.Results[i]; res.ReqID != reqID || res.Status != 413 {
+				t.Errorf("expected 413 for %s, got %+v", reqID, res)
+			}
+		}
+		if res := resp.Results[2]; res.MessageType != 4 {
+			t.Errorf("expected the valid packet to succeed, got %+v", res)
+		}
+		if len(docStore) != 2 {
+			t.Errorf("only the valid packet should be stored, got %d docs", len(docStore))
+		}
+	})
+}
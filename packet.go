@@ -6,6 +6,20 @@ type Packet struct {
 	HandlerID uint8    `json:"handler_id"`
 	ReqID     string   `json:"req_id"`
 	Data      [][]byte `json:"data"`
+
+	// IdempotencyKey lets the server deduplicate a create that the client
+	// may retry: a repeated key gets the result of the first successful
+	// create. Creates without a key are never retried automatically.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+	// Version is the entity tag (ETag) of the data. Requests use it as
+	// If-None-Match for reads and If-Match for updates/deletes; results
+	// carry the current tag of the returned data.
+	Version string `json:"version,omitempty"`
+
+	// Cursor is the change feed sequence number of sync packets ('s'):
+	// the last change seen by the client in requests, the new position in results.
+	Cursor uint64 `json:"cursor,omitempty"`
 }
 
 // BatchRequest is what is sent in the POST /sync
@@ -20,8 +34,10 @@ type BatchResponse struct {
 
 type PacketResult struct {
 	Packet             // Embed Packet complete for symmetry with BatchRequest
-	MessageType uint8  `json:"message_type"` // 0=Normal, 1=Info, 2=Error, 3=Warning, 4=Success
-	Message     string `json:"message"`      // Message for the user
+	MessageType uint8  `json:"message_type"`         // 0=Normal, 1=Info, 2=Error, 3=Warning, 4=Success
+	Message     string `json:"message"`              // Message for the user
+	Status      uint16 `json:"status,omitempty"`     // HTTP-like status (304, 412...), 0 when not relevant
+	Resolution  string `json:"resolution,omitempty"` // Outcome of a resolved version conflict
 }
 
 // Request represents a single operation request for automatic endpoints
@@ -36,4 +52,6 @@ type Response struct {
 	Data        [][]byte `json:"data"`
 	MessageType uint8    `json:"message_type"`
 	Message     string   `json:"message"`
+	Status      uint16   `json:"status,omitempty"`
+	Resolution  string   `json:"resolution,omitempty"`
 }
@@ -0,0 +1,235 @@
+package crudp
+
+import (
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Decision is the answer of an AccessPolicy
+type Decision uint8
+
+const (
+	Abstain Decision = iota // No opinion, e.g. the policy does not apply
+	Allow
+	Deny
+)
+
+// String returns "abstain", "allow" or "deny"
+func (d Decision) String() string {
+	switch d {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	}
+	return "abstain"
+}
+
+// Verdict is a Decision with the reason behind it. Reasons of denials are
+// passed to the AccessDeniedHandler.
+type Verdict struct {
+	Decision Decision
+	Reason   string
+}
+
+// PolicyMode combines the verdicts of a policy chain
+type PolicyMode uint8
+
+const (
+	// AllOf (AND): any Deny denies; at least one policy must Allow
+	AllOf PolicyMode = iota
+	// AnyOf (OR): any Allow allows
+	AnyOf
+	// FirstMatch: the first policy that does not Abstain decides
+	FirstMatch
+)
+
+// AccessPolicy decides whether a caller may run an action on a handler
+type AccessPolicy interface {
+	Decide(req *AccessRequest) Verdict
+}
+
+// PolicyFunc adapts a function to AccessPolicy
+type PolicyFunc func(req *AccessRequest) Verdict
+
+// Decide calls f
+func (f PolicyFunc) Decide(req *AccessRequest) Verdict {
+	return f(req)
+}
+
+// AccessRequest describes one access decision
+type AccessRequest struct {
+	Handler      string
+	Action       byte
+	UserID       string // From SetUserID
+	Roles        []byte // Effective roles (SetUserRoles expanded by the role hierarchy)
+	AllowedRoles []byte // AllowedRoles(Action) of the handler, nil if not implemented
+	Tenant       string
+	Data         []any // Request data, as received by SetUserRoles
+
+	handler  actionHandler
+	record   any
+	recorded bool
+}
+
+// accessPolicies is the chain configured by SetAccessPolicies
+type accessPolicies struct {
+	mode     PolicyMode
+	policies []AccessPolicy
+}
+
+// SetAccessPolicies replaces the access check by a chain of policies
+// combined with mode. SetAccessCheck and AllowedRoles are only used through
+// the ExternalCheck and StaticRoles policies then. No policies restores
+// the default check.
+func (cp *CrudP) SetAccessPolicies(mode PolicyMode, policies ...AccessPolicy) {
+	if len(policies) == 0 {
+		cp.policies = nil
+		return
+	}
+	cp.policies = &accessPolicies{mode: mode, policies: policies}
+}
+
+// Record returns the record targeted by the action: the payload for 'c',
+// the stored entity for 'u' and 'd' (loaded with Read, nil if it cannot be
+// read) and nil for 'r'.
+func (r *AccessRequest) Record() any {
+	if r.recorded {
+		return r.record
+	}
+	r.recorded = true
+
+	id, payload := callArgs(r.Data)
+	switch r.Action {
+	case 'c':
+		r.record = payload
+	case 'u', 'd':
+		if stored := storedFrom(r.Data); stored != nil {
+			r.record, _ = stored.load()
+			break
+		}
+		h := r.handler
+		if h.tenantScoped && r.Tenant != "" {
+			if bound, err := h.withTenant(r.Tenant); err == nil {
+				h = bound
+			}
+		}
+		if target := entityID(id, payload, nil); target != "" && h.Read != nil {
+			if stored, err := h.Read(target); err == nil {
+				r.record = stored
+			}
+		}
+	}
+	return r.record
+}
+
+// accessRequest describes the caller for the policies; roles are the
+// effective roles
+func (cp *CrudP) accessRequest(handler actionHandler, action byte, userID string, roles []byte, data ...any) *AccessRequest {
+	req := &AccessRequest{
+		Handler: handler.name,
+		Action:  action,
+		UserID:  userID,
+		Roles:   roles,
+		Tenant:  cp.tenantOf(data...),
+		Data:    data,
+		handler: handler,
+	}
+	if handler.AllowedRoles != nil {
+		req.AllowedRoles = handler.AllowedRoles(action)
+	}
+	return req
+}
+
+// decide runs the chain on req. verdicts holds the answer of each policy
+// evaluated, in order; evaluation stops as soon as the outcome is known.
+func (c *accessPolicies) decide(req *AccessRequest) (allowed bool, reason string, verdicts []Verdict) {
+	for _, p := range c.policies {
+		v := p.Decide(req)
+		verdicts = append(verdicts, v)
+		switch {
+		case v.Decision == Deny && c.mode != AnyOf:
+			return false, v.Reason, verdicts
+		case v.Decision == Allow && c.mode != AllOf:
+			return true, v.Reason, verdicts
+		case v.Decision == Allow:
+			allowed = true
+		case v.Decision == Deny && reason == "":
+			reason = v.Reason
+		}
+	}
+	if allowed {
+		return true, "", verdicts
+	}
+	if reason == "" {
+		reason = "no policy allowed access"
+	}
+	return false, reason, verdicts
+}
+
+// StaticRoles allows callers having any of the handler's AllowedRoles
+// ('*' for any role). It abstains for handlers without AllowedRoles.
+func StaticRoles() AccessPolicy {
+	return PolicyFunc(func(req *AccessRequest) Verdict {
+		if req.handler.AllowedRoles == nil {
+			return Verdict{Decision: Abstain}
+		}
+		if hasAnyRole(req.Roles, req.AllowedRoles) {
+			return Verdict{Decision: Allow, Reason: "role granted"}
+		}
+		return Verdict{Decision: Deny, Reason: Sprintf("required roles %q, user has %q", string(req.AllowedRoles), string(req.Roles))}
+	})
+}
+
+// ExternalCheck wraps an external check such as rbac.HasPermission (same
+// signature as SetAccessCheck)
+func ExternalCheck(fn func(resource string, action byte, data ...any) bool) AccessPolicy {
+	return PolicyFunc(func(req *AccessRequest) Verdict {
+		if fn(req.Handler, req.Action, req.Data...) {
+			return Verdict{Decision: Allow, Reason: "external check granted"}
+		}
+		return Verdict{Decision: Deny, Reason: "denied by external check"}
+	})
+}
+
+// RecordOwner allows callers owning the targeted record (see
+// AccessRequest.Record) and denies the others. owner returns the user id
+// of a record. It abstains for reads and creates without a payload, and
+// denies updates and deletes whose stored record cannot be loaded.
+func RecordOwner(owner func(record any) string) AccessPolicy {
+	return PolicyFunc(func(req *AccessRequest) Verdict {
+		record := req.Record()
+		if record == nil && (req.Action == 'u' || req.Action == 'd') {
+			return Verdict{Decision: Deny, Reason: "record not found"}
+		}
+		if record == nil {
+			return Verdict{Decision: Abstain}
+		}
+		if req.UserID != "" && owner(record) == req.UserID {
+			return Verdict{Decision: Allow, Reason: "record owner"}
+		}
+		return Verdict{Decision: Deny, Reason: "record owned by another user"}
+	})
+}
+
+// TimeWindow denies calls outside the daily window [start, end), given as
+// offsets from midnight in loc (time.Local when nil). A window with end
+// before start spans midnight. It never allows: use it with AllOf.
+func TimeWindow(start, end time.Duration, loc *time.Location) AccessPolicy {
+	if loc == nil {
+		loc = time.Local
+	}
+	return PolicyFunc(func(req *AccessRequest) Verdict {
+		now := time.Now().In(loc)
+		offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+		inside := offset >= start && offset < end
+		if end < start {
+			inside = offset >= start || offset < end
+		}
+		if inside {
+			return Verdict{Decision: Abstain}
+		}
+		return Verdict{Decision: Deny, Reason: "outside allowed hours"}
+	})
+}
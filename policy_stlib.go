@@ -0,0 +1,41 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"net"
+)
+
+// IPAllowlist denies requests whose client address (http.Request
+// RemoteAddr) is outside the given CIDR ranges or addresses. It never
+// allows: use it with AllOf.
+func IPAllowlist(cidrs ...string) (AccessPolicy, error) {
+	var networks []*net.IPNet
+	for _, c := range cidrs {
+		if ip := net.ParseIP(c); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, errorf("invalid IP allowlist entry: %s", c)
+		}
+		networks = append(networks, network)
+	}
+
+	return PolicyFunc(func(req *AccessRequest) Verdict {
+		addr := requestIP(req.Data...)
+		if ip := net.ParseIP(addr); ip != nil {
+			for _, n := range networks {
+				if n.Contains(ip) {
+					return Verdict{Decision: Abstain}
+				}
+			}
+		}
+		return Verdict{Decision: Deny, Reason: "ip not allowed: " + addr}
+	}), nil
+}
@@ -0,0 +1,185 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/crudp"
+)
+
+type Memo struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+}
+
+var memoStore map[string]*Memo
+
+func (m *Memo) HandlerName() string { return "memos" }
+func (m *Memo) Create(payload any) (any, error) {
+	memo := payload.(*Memo)
+	memoStore[memo.ID] = memo
+	return memo, nil
+}
+func (m *Memo) Read(id string) (any, error) {
+	if stored, ok := memoStore[id]; ok {
+		return stored, nil
+	}
+	return nil, &crudp.StatusError{Code: 404, Message: "not found"}
+}
+func (m *Memo) List() (any, error) { return []*Memo{}, nil }
+func (m *Memo) Update(payload any) (any, error) {
+	memo := payload.(*Memo)
+	memoStore[memo.ID] = memo
+	return memo, nil
+}
+func (m *Memo) ValidateData(byte, any) error { return nil }
+func (m *Memo) AllowedRoles(action byte) []byte {
+	if action == 'r' {
+		return []byte{'*'}
+	}
+	return []byte{'e', 'a'}
+}
+
+func TestAccessPolicies(t *testing.T) {
+	user, roles := "bob", "e"
+	var reasons []string
+	setup := func(mode crudp.PolicyMode, policies ...crudp.AccessPolicy) *crudp.CrudP {
+		memoStore = map[string]*Memo{
+			"1": {ID: "1", Owner: "bob"},
+			"2": {ID: "2", Owner: "carol"},
+		}
+		reasons = nil
+		cp := NewTestCrudP()
+		cp.SetDevMode(false)
+		cp.SetUserID(func(data ...any) string { return user })
+		cp.SetUserRoles(func(data ...any) []byte { return []byte(roles) })
+		cp.SetAccessDeniedHandler(func(handler string, action byte, userRoles, allowedRoles []byte, errMsg string) {
+			reasons = append(reasons, errMsg)
+		})
+		cp.SetAccessPolicies(mode, policies...)
+		if err := cp.RegisterHandlers(&Memo{}); err != nil {
+			t.Fatalf("RegisterHandlers failed: %v", err)
+		}
+		cp.RegisterRoutes(http.NewServeMux())
+		return cp
+	}
+	from := func(ip string) *http.Request {
+		r := httptest.NewRequest("PUT", "/memos/1", nil)
+		r.RemoteAddr = ip + ":4321"
+		return r
+	}
+	owner := crudp.RecordOwner(func(record any) string { return record.(*Memo).Owner })
+
+	t.Run("AllOf", func(t *testing.T) {
+		office, err := crudp.IPAllowlist("10.0.0.0/8", "192.168.1.7")
+		if err != nil {
+			t.Fatalf("IPAllowlist failed: %v", err)
+		}
+		cp := setup(crudp.AllOf, crudp.StaticRoles(), owner, office)
+		user, roles = "bob", "e"
+
+		if _, err := cp.CallHandler(0, 'u', from("10.1.2.3"), "1", &Memo{ID: "1", Owner: "bob"}); err != nil {
+			t.Errorf("owner in the office should update: %v", err)
+		}
+		if _, err := cp.CallHandler(0, 'u', from("192.168.1.7"), "2", &Memo{ID: "2", Owner: "bob"}); err == nil {
+			t.Error("expected denial for another user's memo")
+		}
+		if _, err := cp.CallHandler(0, 'u', from("203.0.113.9"), "1", &Memo{ID: "1", Owner: "bob"}); err == nil {
+			t.Error("expected denial outside the allowlist")
+		}
+		roles = "v"
+		if _, err := cp.CallHandler(0, 'u', from("10.1.2.3"), "1", &Memo{ID: "1", Owner: "bob"}); err == nil {
+			t.Error("expected denial without an editor role")
+		}
+		roles = "e"
+
+		want := []string{"record owned by another user", "ip not allowed: 203.0.113.9", `required roles "ea", user has "v"`}
+		if strings.Join(reasons, "|") != strings.Join(want, "|") {
+			t.Errorf("expected reasons %q, got %q", want, reasons)
+		}
+		if memoStore["2"].Owner != "carol" {
+			t.Error("denied update must not be applied")
+		}
+
+		// Reads have no record: RecordOwner abstains
+		if _, err := cp.CallHandler(0, 'r', from("10.0.0.1")); err != nil {
+			t.Errorf("read should be allowed: %v", err)
+		}
+	})
+
+	t.Run("AnyOf", func(t *testing.T) {
+		granted := false
+		external := crudp.ExternalCheck(func(resource string, action byte, data ...any) bool { return granted })
+		cp := setup(crudp.AnyOf, external, crudp.StaticRoles())
+
+		roles = "v"
+		if _, err := cp.CallHandler(0, 'c', &Memo{ID: "3", Owner: "bob"}); err == nil {
+			t.Fatal("expected denial when no policy allows")
+		}
+		if len(reasons) != 1 || reasons[0] != "denied by external check" {
+			t.Errorf("expected first deny reason, got %q", reasons)
+		}
+		granted = true
+		if _, err := cp.CallHandler(0, 'c', &Memo{ID: "3", Owner: "bob"}); err != nil {
+			t.Errorf("external grant should allow: %v", err)
+		}
+		granted, roles = false, "e"
+		if _, err := cp.CallHandler(0, 'c', &Memo{ID: "4", Owner: "bob"}); err != nil {
+			t.Errorf("role should allow: %v", err)
+		}
+	})
+
+	t.Run("FirstMatch", func(t *testing.T) {
+		admins := crudp.PolicyFunc(func(req *crudp.AccessRequest) crudp.Verdict {
+			if strings.IndexByte(string(req.Roles), 'a') >= 0 {
+				return crudp.Verdict{Decision: crudp.Allow, Reason: "admin"}
+			}
+			return crudp.Verdict{Decision: crudp.Abstain}
+		})
+		cp := setup(crudp.FirstMatch, admins, owner)
+
+		user, roles = "alice", "a"
+		if _, err := cp.CallHandler(0, 'u', "2", &Memo{ID: "2", Owner: "carol"}); err != nil {
+			t.Errorf("admin should update any memo: %v", err)
+		}
+		user, roles = "bob", "e"
+		if _, err := cp.CallHandler(0, 'u', "2", &Memo{ID: "2", Owner: "carol"}); err == nil {
+			t.Error("expected denial from RecordOwner")
+		}
+		if _, err := cp.CallHandler(0, 'u', "9", &Memo{ID: "9", Owner: "bob"}); err == nil || reasons[len(reasons)-1] != "record not found" {
+			t.Errorf("expected denial for a record that cannot be loaded, got %v (%q)", err, reasons)
+		}
+		if _, err := cp.CallHandler(0, 'r'); err == nil {
+			t.Error("expected denial when every policy abstains")
+		}
+		if reasons[len(reasons)-1] != "no policy allowed access" {
+			t.Errorf("unexpected reason: %q", reasons)
+		}
+	})
+
+	t.Run("TimeWindow", func(t *testing.T) {
+		now := time.Now().UTC()
+		offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+		day := 24 * time.Hour
+		open := crudp.TimeWindow((offset+day-time.Hour)%day, (offset+time.Hour)%day, time.UTC)
+		closed := crudp.TimeWindow((offset+time.Hour)%day, (offset+2*time.Hour)%day, time.UTC)
+
+		cp := setup(crudp.AllOf, crudp.StaticRoles(), open)
+		if _, err := cp.CallHandler(0, 'r'); err != nil {
+			t.Errorf("call inside the window should pass: %v", err)
+		}
+		cp = setup(crudp.AllOf, crudp.StaticRoles(), closed)
+		if _, err := cp.CallHandler(0, 'r'); err == nil || len(reasons) != 1 || reasons[0] != "outside allowed hours" {
+			t.Errorf("expected denial outside the window, got %v %q", err, reasons)
+		}
+	})
+
+	if _, err := crudp.IPAllowlist("not-an-ip"); err == nil {
+		t.Error("expected error for an invalid allowlist entry")
+	}
+}
@@ -0,0 +1,104 @@
+//go:build wasm
+
+package crudp
+
+import (
+	"syscall/js"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Connect opens the server push stream (an SSEPusher endpoint, e.g. "/events").
+// Pushed results flow through HandleResponse like any other result.
+// Subscriptions are (re)sent every time the stream (re)connects.
+func (cp *CrudP) Connect(endpoint string) {
+	source := js.Global().Get("EventSource").New(endpoint)
+
+	source.Call("addEventListener", "conn", js.FuncOf(func(this js.Value, args []js.Value) any {
+		cp.clientMu.Lock()
+		cp.connID = args[0].Get("data").String()
+		subs := make([]Packet, 0, len(cp.clientSubs))
+		for _, p := range cp.clientSubs {
+			subs = append(subs, p)
+		}
+		cp.clientMu.Unlock()
+
+		if len(subs) > 0 {
+			cp.Send(&BatchRequest{Packets: subs})
+		}
+		return nil
+	}))
+
+	source.Call("addEventListener", "message", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if cp.decode == nil {
+			cp.log("decode function not configured")
+			return nil
+		}
+		var resp BatchResponse
+		if err := cp.decode([]byte(args[0].Get("data").String()), &resp); err != nil {
+			cp.log("error decoding pushed response:", err)
+			return nil
+		}
+		cp.HandleResponse(&resp)
+		return nil
+	}))
+
+	source.Call("addEventListener", "error", js.FuncOf(func(this js.Value, args []js.Value) any {
+		// EventSource reconnects by itself; a new conn event follows
+		cp.clientMu.Lock()
+		cp.connID = ""
+		cp.clientMu.Unlock()
+		return nil
+	}))
+}
+
+// Subscribe asks the server to push create/update/delete results of a
+// handler, or of a single entity when id is not empty.
+func (cp *CrudP) Subscribe(handlerID uint8, id string) {
+	p := subscriptionPacket('+', handlerID, id)
+
+	cp.clientMu.Lock()
+	if cp.clientSubs == nil {
+		cp.clientSubs = make(map[string]Packet)
+	}
+	cp.clientSubs[p.ReqID] = p
+	connected := cp.connID != ""
+	cp.clientMu.Unlock()
+
+	if connected {
+		cp.Send(&BatchRequest{Packets: []Packet{p}})
+	}
+}
+
+// Unsubscribe cancels a subscription made with Subscribe.
+func (cp *CrudP) Unsubscribe(handlerID uint8, id string) {
+	p := subscriptionPacket('-', handlerID, id)
+
+	cp.clientMu.Lock()
+	delete(cp.clientSubs, p.ReqID)
+	connected := cp.connID != ""
+	cp.clientMu.Unlock()
+
+	if connected {
+		cp.Send(&BatchRequest{Packets: []Packet{p}})
+	}
+}
+
+// pushConnID returns the current push connection id, empty when not connected.
+func (cp *CrudP) pushConnID() string {
+	cp.clientMu.Lock()
+	defer cp.clientMu.Unlock()
+	return cp.connID
+}
+
+func subscriptionPacket(action byte, handlerID uint8, id string) Packet {
+	p := Packet{
+		Action:    action,
+		HandlerID: handlerID,
+		ReqID:     Sprintf("sub-%d-%s", handlerID, id),
+	}
+	if id != "" {
+		p.Data = [][]byte{[]byte(id)}
+	}
+	return p
+}
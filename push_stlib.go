@@ -0,0 +1,121 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// SSEPusher is a Pusher over Server-Sent Events.
+//
+//	sse := crudp.NewSSEPusher(cp)
+//	cp.SetPusher(sse, sse.ConnID)
+//	mux.Handle("GET /events", sse)
+//
+// Each stream starts with a "conn" event holding the connection id; every
+// pushed BatchResponse is then sent, encoded, as a "message" event.
+type SSEPusher struct {
+	cp    *CrudP
+	mu    sync.Mutex
+	conns map[string]chan []byte
+}
+
+// NewSSEPusher creates an SSE pusher encoding responses with cp's codec
+func NewSSEPusher(cp *CrudP) *SSEPusher {
+	return &SSEPusher{cp: cp, conns: make(map[string]chan []byte)}
+}
+
+// ServeHTTP opens an event stream and keeps it until the client disconnects
+func (s *SSEPusher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	connID, err := newConnID()
+	if err != nil {
+		http.Error(w, "Error creating connection", http.StatusInternalServerError)
+		return
+	}
+
+	events := make(chan []byte, 16)
+	s.mu.Lock()
+	s.conns[connID] = events
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, connID)
+		s.mu.Unlock()
+		s.cp.DropConnection(connID)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Write([]byte("event: conn\ndata: " + connID + "\n\n"))
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-events:
+			w.Write([]byte("data: "))
+			w.Write(msg)
+			w.Write([]byte("\n\n"))
+			flusher.Flush()
+		}
+	}
+}
+
+// Push sends resp to a connection. Slow connections whose buffer is full
+// lose the message; clients recover with Sync.
+func (s *SSEPusher) Push(connID string, resp *BatchResponse) error {
+	if s.cp.encode == nil {
+		return Errf("encode function not configured")
+	}
+	encoded, err := s.cp.encodeBody(resp)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	events, ok := s.conns[connID]
+	s.mu.Unlock()
+	if !ok {
+		s.cp.DropConnection(connID)
+		return nil
+	}
+
+	select {
+	case events <- encoded:
+	default:
+		s.cp.log("push buffer full for connection:", connID)
+	}
+	return nil
+}
+
+// ConnID reads the connection id from the ConnHeader of the injected *http.Request
+func (s *SSEPusher) ConnID(data ...any) string {
+	for _, d := range data {
+		if r, ok := d.(*http.Request); ok {
+			return r.Header.Get(ConnHeader)
+		}
+	}
+	return ""
+}
+
+func newConnID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
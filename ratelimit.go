@@ -0,0 +1,183 @@
+package crudp
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// RateLimit is a token bucket: Burst requests at once, refilled at Rate
+// requests per second. Each packet (or automatic endpoint call) takes a token.
+// A zero Burst defaults to one second of Rate (at least 1).
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitError is returned when a caller ran out of tokens. It reports
+// status 429; RetryAfter is the wait in seconds until the next token.
+type RateLimitError struct {
+	Handler    string
+	Action     byte
+	RetryAfter int
+}
+
+func (e *RateLimitError) Error() string {
+	return Sprintf("rate limit exceeded for %s '%c', retry in %ds", e.Handler, e.Action, e.RetryAfter)
+}
+
+// StatusCode implements statusCoder
+func (e *RateLimitError) StatusCode() uint16 { return 429 }
+
+// rateNotice collects the longest Retry-After of a request.
+// It travels in CallHandler data like *resolution.
+type rateNotice struct {
+	retryAfter int
+}
+
+// rateLimiter holds the configured limits and the buckets per caller
+type rateLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]RateLimit // by "handler|action", "" and 0 act as wildcards
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	limit  RateLimit
+}
+
+// maxIdleBuckets triggers a sweep of full (idle) buckets
+const maxIdleBuckets = 10000
+
+// SetRateLimit limits how often a caller may run action on handler.
+// handler "" applies to every handler and action 0 to every action; the most
+// specific limit wins. A zero RateLimit removes the limit.
+func (cp *CrudP) SetRateLimit(handler string, action byte, limit RateLimit) {
+	if cp.rateLimiter == nil {
+		cp.rateLimiter = &rateLimiter{limits: map[string]RateLimit{}, buckets: map[string]*tokenBucket{}}
+	}
+	rl := cp.rateLimiter
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	key := rateLimitKey(handler, action)
+	if limit.Rate <= 0 && limit.Burst <= 0 {
+		delete(rl.limits, key)
+	} else {
+		if limit.Burst <= 0 {
+			limit.Burst = int(math.Ceil(limit.Rate))
+		}
+		rl.limits[key] = limit
+	}
+	rl.buckets = map[string]*tokenBucket{}
+}
+
+// SetRateKey configures how callers are identified for rate limiting (same
+// data as SetUserRoles). By default the SetUserID value is used, falling back
+// to the client IP of the injected *http.Request.
+func (cp *CrudP) SetRateKey(fn func(data ...any) string) {
+	cp.getRateKey = fn
+}
+
+// checkRateLimit takes a token from the caller's bucket for handler/action
+func (cp *CrudP) checkRateLimit(handler actionHandler, action byte, data ...any) error {
+	rl := cp.rateLimiter
+	if rl == nil {
+		return nil
+	}
+
+	rl.mu.Lock()
+	limit, scope, ok := rl.lookup(handler.name, action)
+	rl.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	caller := cp.rateCaller(data...)
+	key := caller + "|" + scope
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	b, exists := rl.buckets[key]
+	if !exists {
+		if len(rl.buckets) >= maxIdleBuckets {
+			rl.sweep(now)
+		}
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now, limit: limit}
+		rl.buckets[key] = b
+	}
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return nil
+	}
+
+	retry := 1
+	if limit.Rate > 0 {
+		retry = int((1-b.tokens)/limit.Rate) + 1
+	}
+	for _, d := range data {
+		if notice, ok := d.(*rateNotice); ok && retry > notice.retryAfter {
+			notice.retryAfter = retry
+		}
+	}
+	cp.log("rate limit exceeded for handler:", handler.name, "caller:", caller)
+	return &RateLimitError{Handler: handler.name, Action: action, RetryAfter: retry}
+}
+
+// rateCaller identifies the caller: SetRateKey, SetUserID, then client IP
+func (cp *CrudP) rateCaller(data ...any) string {
+	if cp.getRateKey != nil {
+		return cp.getRateKey(data...)
+	}
+	if cp.getUserID != nil {
+		if id := cp.getUserID(data...); id != "" {
+			return "user:" + id
+		}
+	}
+	return "ip:" + requestIP(data...)
+}
+
+// lookup returns the most specific limit for handler/action and its scope
+func (rl *rateLimiter) lookup(handler string, action byte) (RateLimit, string, bool) {
+	for _, key := range []string{
+		rateLimitKey(handler, action),
+		rateLimitKey(handler, 0),
+		rateLimitKey("", action),
+		rateLimitKey("", 0),
+	} {
+		if limit, ok := rl.limits[key]; ok {
+			return limit, key, true
+		}
+	}
+	return RateLimit{}, "", false
+}
+
+// sweep drops buckets that have refilled completely
+func (rl *rateLimiter) sweep(now time.Time) {
+	for key, b := range rl.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if max := float64(b.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+}
+
+func rateLimitKey(handler string, action byte) string {
+	return handler + "|" + string(action)
+}
@@ -0,0 +1,8 @@
+//go:build wasm
+
+package crudp
+
+// requestIP has no client address in the browser
+func requestIP(data ...any) string {
+	return ""
+}
@@ -0,0 +1,20 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"net"
+)
+
+// requestIP returns the remote address of the injected *http.Request.
+// Proxy headers are not trusted; use SetRateKey behind a reverse proxy.
+func requestIP(data ...any) string {
+	r := requestFrom(data)
+	if r == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
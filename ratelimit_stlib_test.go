@@ -0,0 +1,134 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+func TestRateLimit(t *testing.T) {
+	// A rate this low never refills during the test
+	slow := crudp.RateLimit{Rate: 0.01, Burst: 2}
+
+	t.Run("Per Client IP", func(t *testing.T) {
+		cp, mux := newDocServer(t)
+		cp.SetRateLimit("docs", 'r', slow)
+
+		get := func(addr string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", "/docs/1", nil)
+			req.RemoteAddr = addr
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			return rec
+		}
+		for i := 0; i < 2; i++ {
+			if rec := get("10.0.0.1:1000"); rec.Code != http.StatusOK {
+				t.Fatalf("request %d: expected 200, got %d", i, rec.Code)
+			}
+		}
+		rec := get("10.0.0.1:2000")
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected 429, got %d", rec.Code)
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+		if rec := get("10.0.0.2:1000"); rec.Code != http.StatusOK {
+			t.Errorf("another client must have its own bucket, got %d", rec.Code)
+		}
+
+		// Other actions are not limited
+		req := httptest.NewRequest("DELETE", "/docs/1", nil)
+		req.RemoteAddr = "10.0.0.1:1000"
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("delete should not be limited, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Each Batch Packet Counts", func(t *testing.T) {
+		cp, mux := newDocServer(t)
+		cp.SetUserID(func(data ...any) string { return "alice" })
+		cp.SetRateLimit("", 0, slow)
+
+		read := crudp.Packet{Action: 'r', ReqID: "r"}
+		post := func(packets ...crudp.Packet) (*httptest.ResponseRecorder, crudp.BatchResponse) {
+			var body []byte
+			jsonEncode(crudp.BatchRequest{Packets: packets}, &body)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("POST", "/batch", httpBodyFromBytes(body)))
+			var resp crudp.BatchResponse
+			if err := jsonDecode(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			return rec, resp
+		}
+
+		rec, resp := post(read, read, read)
+		if rec.Code != http.StatusOK || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("expected 200 with Retry-After for a partially limited batch, got %d", rec.Code)
+		}
+		for i, res := range resp.Results {
+			limited := res.Status == http.StatusTooManyRequests
+			if limited != (i == 2) {
+				t.Errorf("packet %d: unexpected result %+v", i, res)
+			}
+		}
+
+		rec, _ = post(read)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("expected 429 when every packet is limited, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Default Burst", func(t *testing.T) {
+		cp, _ := newDocServer(t)
+		cp.SetUserID(func(data ...any) string { return "alice" })
+		cp.SetRateLimit("docs", 'r', crudp.RateLimit{Rate: 3})
+		for i := 0; i < 3; i++ {
+			if _, err := cp.CallHandler(0, 'r', "1"); err != nil {
+				t.Fatalf("read %d within one second of rate: %v", i, err)
+			}
+		}
+		if _, err := cp.CallHandler(0, 'r', "1"); err == nil {
+			t.Error("expected the fourth read limited")
+		}
+	})
+
+	t.Run("Sync And Subscriptions Count", func(t *testing.T) {
+		cp, _ := newDocServer(t)
+		cp.SetUserID(func(data ...any) string { return "alice" })
+		cp.SetChangeLog(crudp.NewMemoryChangeLog(10))
+		cp.SetPusher(&fakePusher{pushed: map[string][]crudp.PacketResult{}}, crudp.NewSSEPusher(cp).ConnID)
+		cp.SetRateLimit("", 0, crudp.RateLimit{Rate: 0.01, Burst: 1})
+		sink := &memoryAudit{}
+		cp.SetAuditSink(sink)
+
+		for _, action := range []byte{'s', '+'} {
+			packet := crudp.Packet{Action: action, ReqID: "p"}
+			resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{packet, packet}}, connRequest("c1"))
+			if status := resp.Results[0].Status; status != 0 {
+				t.Errorf("%c: expected the first packet served, got %d", action, status)
+			}
+			if last := resp.Results[len(resp.Results)-1]; last.Status != http.StatusTooManyRequests {
+				t.Errorf("%c: expected the second packet limited, got %+v", action, last)
+			}
+			cp.SetRateLimit("", 0, crudp.RateLimit{Rate: 0.01, Burst: 1})
+		}
+
+		if len(sink.entries) != 4 {
+			t.Fatalf("expected 4 audit entries, got %+v", sink.entries)
+		}
+		if e := sink.entries[1]; e.Action != 's' || !e.Denied || e.Status != http.StatusTooManyRequests {
+			t.Errorf("expected the limited sync audited as denied, got %+v", e)
+		}
+		if e := sink.entries[2]; e.Action != '+' || e.Denied || e.Actor != "alice" {
+			t.Errorf("expected the subscription audited, got %+v", e)
+		}
+	})
+}
@@ -0,0 +1,291 @@
+package crudp
+
+import (
+	"reflect"
+)
+
+// callPolicy applies a handler's tenant isolation, RecordAccess and field
+// policies to one caller
+type callPolicy struct {
+	cp      *CrudP
+	handler actionHandler
+	userID  string
+	roles   []byte
+	tenant  string // Caller's tenant, empty when isolation does not apply
+	access  bool   // RecordAccess and field policies apply (not in dev mode)
+}
+
+// SetRecordDeniedAsNotFound reports records denied by RecordAccess as 404
+// (hiding that they exist) instead of 403. Lists always drop denied items.
+func (cp *CrudP) SetRecordDeniedAsNotFound(enabled bool) {
+	cp.recordNotFound = enabled
+}
+
+// policyFor binds handler's policies to the caller in data. It returns nil
+// when none apply or checks are off (client side). Dev mode skips record and
+// field policies but keeps tenants isolated.
+func (cp *CrudP) policyFor(handler actionHandler, tenant string, data ...any) *callPolicy {
+	p := cp.newPolicy(handler, tenant)
+	if p == nil {
+		return nil
+	}
+	if cp.getUserID != nil {
+		p.userID = cp.getUserID(data...)
+	}
+	if cp.getUserRoles != nil {
+		p.roles = cp.effectiveRoles(cp.getUserRoles(data...))
+	}
+	return p
+}
+
+// newPolicy returns handler's policies for a caller of tenant, without the
+// caller's identity. nil when none apply.
+func (cp *CrudP) newPolicy(handler actionHandler, tenant string) *callPolicy {
+	if !cp.policyChecks {
+		return nil
+	}
+	p := &callPolicy{cp: cp, handler: handler}
+	p.access = !cp.devMode && (handler.AllowRecord != nil || len(handler.fields) > 0)
+	if handler.tenantScoped && cp.getTenant != nil {
+		p.tenant = tenant
+	}
+	if !p.access && p.tenant == "" {
+		return nil
+	}
+	return p
+}
+
+// before checks a create, update or delete: the tenant of the payload and
+// of the stored entity, record access, then the fields the caller may write
+func (p *callPolicy) before(action byte, id string, payload any, entity *storedEntity) error {
+	h := p.handler
+	target := entityID(id, payload, nil)
+
+	var stored any
+	needStored := p.tenant != "" || (p.access && (h.AllowRecord != nil || (action == 'u' && len(h.fields) > 0)))
+	if needStored {
+		if s, err := entity.load(); err == nil {
+			stored = s
+		}
+	}
+
+	if p.tenant != "" {
+		if action != 'd' && !ownedBy(payload, p.tenant) {
+			p.denied(action, target, "cross-tenant write denied")
+			return &StatusError{Code: 403, Message: "cross-tenant access denied"}
+		}
+		// The tenant of a TenantOwned entity is only known once it is loaded
+		if (action == 'u' || action == 'd') && h.tenantOwned {
+			if target == "" {
+				p.denied(action, target, "tenant check requires an entity id")
+				return &StatusError{Code: 400, Message: "entity id required"}
+			}
+			if stored == nil {
+				p.denied(action, target, "tenant check could not read the entity")
+				return &StatusError{Code: 404, Message: "not found"}
+			}
+		}
+		if stored != nil && !ownedBy(stored, p.tenant) {
+			p.denied(action, target, "cross-tenant access denied")
+			return &StatusError{Code: 404, Message: "not found"}
+		}
+	}
+	if !p.access {
+		return nil
+	}
+
+	if h.AllowRecord != nil {
+		record := payload
+		if action == 'u' || action == 'd' {
+			record = stored
+		}
+		if !p.allowRecord(action, target, record) {
+			return p.cp.recordDenied()
+		}
+	}
+	if action == 'c' || action == 'u' {
+		return h.checkFieldWrites(p.roles, payload, stored)
+	}
+	return nil
+}
+
+// after filters a result: entities of other tenants, denied records of a
+// read, then hidden fields
+func (p *callPolicy) after(action byte, id string, result any) (any, error) {
+	if p.tenant != "" || (action == 'r' && p.access && p.handler.AllowRecord != nil) {
+		var err error
+		if result, err = p.filterRecords(action, id, result); err != nil {
+			return nil, err
+		}
+	}
+	return p.strip(result), nil
+}
+
+// strip returns entity as the caller may read it
+func (p *callPolicy) strip(entity any) any {
+	if p == nil || !p.access {
+		return entity
+	}
+	return p.handler.stripFields(p.roles, entity)
+}
+
+// conflict strips the stored copy carried by a ConflictError down to the
+// fields the caller may read
+func (p *callPolicy) conflict(err error) error {
+	conflict, ok := err.(*ConflictError)
+	if p == nil || !p.access || !ok || conflict.Current == nil {
+		return err
+	}
+	return &ConflictError{Code: conflict.Code, Current: p.strip(conflict.Current)}
+}
+
+// sink applies the policies to each streamed item; denied items are skipped
+func (p *callPolicy) sink(sink streamSink) streamSink {
+	return func(item any) bool {
+		if p.visible('r', entityID("", item, nil), item) != nil {
+			return true
+		}
+		if p.access {
+			item = p.handler.stripFields(p.roles, item)
+		}
+		return sink(item)
+	}
+}
+
+// change applies RecordAccess and field policies to the entity of a logged
+// change (feed, sync or push), like a read result. data is encoded with the
+// default codec. out is data re-encoded without the fields the caller may
+// not read, and nil for deletes; ok is false when the caller may not see
+// the entity. A delete passes when the caller could read the entity before
+// it was deleted; without it, only when RecordAccess does not apply.
+func (p *callPolicy) change(action byte, id string, data []byte) (out []byte, ok bool) {
+	if action == 'd' {
+		return nil, p == nil || !p.access || p.handler.AllowRecord == nil || (data != nil && p.readable(id, data))
+	}
+	if p == nil || !p.access {
+		return data, true
+	}
+	h := p.handler
+	entity, err := p.cp.decodeEntity(h, data)
+	if err != nil {
+		p.cp.log("change decode failed for handler:", h.name, err)
+		return nil, false
+	}
+	if !p.allowRecord('r', id, entity) {
+		return nil, false
+	}
+	if len(h.fields) == 0 {
+		return data, true
+	}
+	out = p.cp.mutationData('u', nil, h.stripFields(p.roles, entity))
+	return out, out != nil
+}
+
+// readable decodes an entity encoded with the default codec and runs
+// RecordAccess ('r') on it
+func (p *callPolicy) readable(id string, data []byte) bool {
+	entity, err := p.cp.decodeEntity(p.handler, data)
+	if err != nil {
+		p.cp.log("change decode failed for handler:", p.handler.name, err)
+		return false
+	}
+	return p.allowRecord('r', id, entity)
+}
+
+// visible checks the tenant and RecordAccess of a result entity
+func (p *callPolicy) visible(action byte, id string, record any) error {
+	if p.tenant != "" && !ownedBy(record, p.tenant) {
+		p.denied(action, id, "cross-tenant access denied")
+		return &StatusError{Code: 404, Message: "not found"}
+	}
+	if action == 'r' && !p.allowRecord(action, id, record) {
+		return p.cp.recordDenied()
+	}
+	return nil
+}
+
+// allowRecord runs RecordAccess, reporting denials
+func (p *callPolicy) allowRecord(action byte, id string, record any) bool {
+	h := p.handler
+	if !p.access || h.AllowRecord == nil || h.AllowRecord(action, p.userID, p.roles, id, record) {
+		return true
+	}
+	p.denied(action, id, "record access denied")
+	return false
+}
+
+// denied reports a record-level denial to the AccessDeniedHandler and the log
+func (p *callPolicy) denied(action byte, id, reason string) {
+	msg := reason + ": " + id
+	if p.tenant != "" {
+		msg += " (tenant " + p.tenant + ")"
+	}
+	if p.cp.accessDeniedHandler != nil {
+		p.cp.accessDeniedHandler(p.handler.name, action, p.roles, nil, msg)
+	}
+	if p.tenant != "" {
+		p.cp.log(reason, "for handler:", p.handler.name, "id:", id, "tenant:", p.tenant)
+		return
+	}
+	p.cp.log(reason, "for handler:", p.handler.name, "id:", id)
+}
+
+// filterRecords checks a result: a single entity is denied as a whole,
+// the items of a list are dropped one by one
+func (p *callPolicy) filterRecords(action byte, id string, result any) (any, error) {
+	v := reflect.ValueOf(result)
+	if id != "" || v.Kind() != reflect.Slice {
+		if err := p.visible(action, entityID(id, nil, result), result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	kept := reflect.MakeSlice(v.Type(), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i)
+		if p.visible(action, entityID("", nil, item.Interface()), item.Interface()) == nil {
+			kept = reflect.Append(kept, item)
+		}
+	}
+	return kept.Interface(), nil
+}
+
+// storedEntity is the entity targeted by an update or delete. It is read at
+// most once per call.
+type storedEntity struct {
+	read   func(id string) (any, error)
+	id     string
+	loaded bool
+	entity any
+	err    error
+}
+
+// load reads the entity on first use; nil without an id or a Read method
+func (s *storedEntity) load() (any, error) {
+	if s == nil || s.id == "" || s.read == nil {
+		return nil, nil
+	}
+	if !s.loaded {
+		s.loaded = true
+		s.entity, s.err = s.read(s.id)
+	}
+	return s.entity, s.err
+}
+
+// storedFrom returns the storedEntity injected by CallHandler, or nil
+func storedFrom(data []any) *storedEntity {
+	for _, d := range data {
+		if s, ok := d.(*storedEntity); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+func (cp *CrudP) recordDenied() error {
+	if cp.recordNotFound {
+		return &StatusError{Code: 404, Message: "not found"}
+	}
+	return &StatusError{Code: 403, Message: "access denied"}
+}
@@ -0,0 +1,195 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+type Patient struct {
+	ID     string `json:"id"`
+	Doctor string `json:"doctor"`
+}
+
+var patientStore map[string]*Patient
+
+func (p *Patient) HandlerName() string { return "patients" }
+func (p *Patient) Read(id string) (any, error) {
+	if stored, ok := patientStore[id]; ok {
+		return stored, nil
+	}
+	return nil, &crudp.StatusError{Code: 404, Message: "not found"}
+}
+func (p *Patient) List() (any, error) {
+	list := []*Patient{}
+	for _, id := range []string{"1", "2", "3"} {
+		if stored, ok := patientStore[id]; ok {
+			list = append(list, stored)
+		}
+	}
+	return list, nil
+}
+func (p *Patient) Delete(id string) error {
+	delete(patientStore, id)
+	return nil
+}
+func (p *Patient) Update(payload any) (any, error) {
+	patient := payload.(*Patient)
+	patientStore[patient.ID] = patient
+	return patient, nil
+}
+func (p *Patient) ValidateData(byte, any) error    { return nil }
+func (p *Patient) AllowedRoles(action byte) []byte { return []byte{'*'} }
+func (p *Patient) EntityID() string                { return p.ID }
+func (p *Patient) Version() string                 { return "1" }
+
+// Doctors may only access their own patients; admins access all
+func (p *Patient) AllowRecord(action byte, userID string, roles []byte, id string, record any) bool {
+	for _, r := range roles {
+		if r == 'a' {
+			return true
+		}
+	}
+	patient, ok := record.(*Patient)
+	return ok && patient.Doctor == userID
+}
+
+func newPatientServer(t *testing.T, user string, roles string) (*crudp.CrudP, *http.ServeMux) {
+	patientStore = map[string]*Patient{
+		"1": {ID: "1", Doctor: "house"},
+		"2": {ID: "2", Doctor: "wilson"},
+		"3": {ID: "3", Doctor: "house"},
+	}
+	cp := NewTestCrudP()
+	cp.SetDevMode(false)
+	cp.SetUserID(func(data ...any) string { return user })
+	cp.SetUserRoles(func(data ...any) []byte { return []byte(roles) })
+	if err := cp.RegisterHandlers(&Patient{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	cp.RegisterRoutes(mux)
+	return cp, mux
+}
+
+func TestRecordAccess(t *testing.T) {
+	do := func(mux *http.ServeMux, method, path string) (int, crudp.Response) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		var resp crudp.Response
+		jsonDecode(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	t.Run("List Is Filtered", func(t *testing.T) {
+		_, mux := newPatientServer(t, "house", "d")
+		_, resp := do(mux, "GET", "/patients/")
+		if len(resp.Data) != 2 {
+			t.Fatalf("expected 2 own patients, got %d", len(resp.Data))
+		}
+		for _, item := range resp.Data {
+			var p Patient
+			jsonDecode(item, &p)
+			if p.Doctor != "house" {
+				t.Errorf("foreign patient leaked: %+v", p)
+			}
+		}
+
+		_, mux = newPatientServer(t, "cuddy", "a")
+		if _, resp := do(mux, "GET", "/patients/"); len(resp.Data) != 3 {
+			t.Errorf("admin should list all patients, got %d", len(resp.Data))
+		}
+	})
+
+	t.Run("Single Read Denied", func(t *testing.T) {
+		cp, mux := newPatientServer(t, "house", "d")
+		if code, _ := do(mux, "GET", "/patients/1"); code != http.StatusOK {
+			t.Errorf("own patient: expected 200, got %d", code)
+		}
+		if code, _ := do(mux, "GET", "/patients/2"); code != http.StatusForbidden {
+			t.Errorf("foreign patient: expected 403, got %d", code)
+		}
+
+		cp.SetRecordDeniedAsNotFound(true)
+		if code, _ := do(mux, "GET", "/patients/2"); code != http.StatusNotFound {
+			t.Errorf("foreign patient: expected 404, got %d", code)
+		}
+	})
+
+	t.Run("Delete Checked Before Execution", func(t *testing.T) {
+		_, mux := newPatientServer(t, "house", "d")
+		if code, _ := do(mux, "DELETE", "/patients/2"); code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", code)
+		}
+		if _, ok := patientStore["2"]; !ok {
+			t.Error("foreign patient must not be deleted")
+		}
+		if code, _ := do(mux, "DELETE", "/patients/1"); code != http.StatusOK {
+			t.Errorf("expected 200, got %d", code)
+		}
+	})
+
+	t.Run("Changes Are Filtered Per Reader", func(t *testing.T) {
+		cp, _ := newPatientServer(t, "house", "d")
+		user, roles := "house", "d"
+		cp.SetUserID(func(data ...any) string { return user })
+		cp.SetUserRoles(func(data ...any) []byte { return []byte(roles) })
+		cp.SetChangeLog(crudp.NewMemoryChangeLog(100))
+		mux := http.NewServeMux()
+		cp.RegisterRoutes(mux)
+		pusher := &fakePusher{pushed: map[string][]crudp.PacketResult{}}
+		cp.SetPusher(pusher, crudp.NewSSEPusher(cp).ConnID)
+		cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: '+', ReqID: "s1"}}}, connRequest("house"))
+
+		user, roles = "cuddy", "a"
+		for _, p := range []*Patient{{ID: "1", Doctor: "house"}, {ID: "2", Doctor: "wilson"}} {
+			if _, err := cp.CallHandler(0, 'u', p); err != nil {
+				t.Fatalf("update failed: %v", err)
+			}
+		}
+		user, roles = "house", "d"
+
+		if pushed := pusher.pushed["house"]; len(pushed) != 1 || !strings.Contains(string(pushed[0].Data[0]), `"id":"1"`) {
+			t.Errorf("expected only the own patient pushed, got %+v", pushed)
+		}
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/changes?since=0", nil))
+		var feed crudp.ChangeFeed
+		jsonDecode(rec.Body.Bytes(), &feed)
+		if len(feed.Changes) != 1 || feed.Changes[0].ID != "1" || feed.Cursor != 2 {
+			t.Errorf("expected only the own patient in the feed, got %+v", feed)
+		}
+
+		resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 's', HandlerID: 0, ReqID: "y1"}}})
+		if len(resp.Results) != 3 || resp.Results[0].Action != 'u' || resp.Results[1].Action != 'd' || string(resp.Results[1].Data[0]) != "2" {
+			t.Errorf("expected the foreign patient synced as a tombstone, got %+v", resp.Results)
+		}
+
+		// Tombstones are checked against the entity as it was before the delete
+		user, roles = "cuddy", "a"
+		cp.CallHandler(0, 'd', "2")
+		cp.CallHandler(0, 'd', "3")
+		user, roles = "house", "d"
+
+		if pushed := pusher.pushed["house"]; len(pushed) != 2 || pushed[1].Action != 'd' || string(pushed[1].Data[0]) != "3" {
+			t.Errorf("expected only the own patient's delete pushed, got %+v", pushed)
+		}
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/changes?since=2", nil))
+		feed = crudp.ChangeFeed{}
+		jsonDecode(rec.Body.Bytes(), &feed)
+		if len(feed.Changes) != 1 || feed.Changes[0].ID != "3" || feed.Changes[0].Data != nil {
+			t.Errorf("expected only the own patient's delete in the feed, got %+v", feed)
+		}
+		resp, _ = cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 's', HandlerID: 0, ReqID: "y2", Cursor: 2}}})
+		if len(resp.Results) != 2 || resp.Results[0].Action != 'd' || string(resp.Results[0].Data[0]) != "3" {
+			t.Errorf("expected only the own patient's tombstone synced, got %+v", resp.Results)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package crudp
+
+import (
+	"math/rand"
+)
+
+// RetryPolicy controls how the WASM client retries outgoing batches that fail
+// with a transient error (network failure or retryable HTTP status).
+// Delays are expressed in milliseconds, matching fetch.Request.Timeout.
+type RetryPolicy struct {
+	MaxAttempts int                              // Total attempts including the first one (<= 1 disables retries)
+	BaseDelay   int                              // Backoff before the first retry in milliseconds
+	MaxDelay    int                              // Upper bound for a single backoff in milliseconds (0 = unbounded)
+	Jitter      bool                             // Randomizes each delay between 50% and 100% of its value
+	Retryable   func(status int, err error) bool // Failure classifier. nil uses IsTransientFailure
+}
+
+// DefaultRetryPolicy returns a policy with 4 attempts and jittered
+// exponential backoff starting at 200ms and capped at 5s.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   200,
+		MaxDelay:    5000,
+		Jitter:      true,
+	}
+}
+
+// IsTransientFailure reports whether a failed round trip is worth retrying:
+// network errors, timeouts, throttling and temporary server errors.
+func IsTransientFailure(status int, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch status {
+	case 408, 425, 429, 500, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// ShouldRetry reports whether a batch that failed on the given attempt
+// (1-based) must be sent again.
+func (p RetryPolicy) ShouldRetry(attempt, status int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(status, err)
+	}
+	return IsTransientFailure(status, err)
+}
+
+// Delay returns the backoff in milliseconds before retry number attempt (1-based).
+func (p RetryPolicy) Delay(attempt int) int {
+	if attempt < 1 || p.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter && delay > 1 {
+		half := delay / 2
+		delay = half + rand.Intn(delay-half+1)
+	}
+	return delay
+}
+
+// IsRetrySafe reports whether a packet can be sent more than once without
+// side effects. Reads, updates and deletes are idempotent; creates are only
+// safe when they carry an IdempotencyKey the server can deduplicate on.
+func IsRetrySafe(p *Packet) bool {
+	if p.Action == 'c' {
+		return p.IdempotencyKey != ""
+	}
+	return true
+}
+
+// splitRetrySafe separates the packets that may be retried from those that must not.
+func splitRetrySafe(packets []Packet) (safe, unsafe []Packet) {
+	for _, p := range packets {
+		if IsRetrySafe(&p) {
+			safe = append(safe, p)
+		} else {
+			unsafe = append(unsafe, p)
+		}
+	}
+	return safe, unsafe
+}
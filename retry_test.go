@@ -0,0 +1,57 @@
+package crudp_test
+
+import (
+	"testing"
+
+	"github.com/tinywasm/crudp"
+	. "github.com/tinywasm/fmt"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Run("Exponential Backoff Capped", func(t *testing.T) {
+		p := crudp.RetryPolicy{MaxAttempts: 5, BaseDelay: 100, MaxDelay: 350}
+		want := []int{100, 200, 350, 350}
+		for i, w := range want {
+			if got := p.Delay(i + 1); got != w {
+				t.Errorf("attempt %d: expected delay %d, got %d", i+1, w, got)
+			}
+		}
+	})
+
+	t.Run("Jitter Within Bounds", func(t *testing.T) {
+		p := crudp.RetryPolicy{MaxAttempts: 3, BaseDelay: 100, Jitter: true}
+		for i := 0; i < 50; i++ {
+			if got := p.Delay(2); got < 100 || got > 200 {
+				t.Fatalf("jittered delay out of range: %d", got)
+			}
+		}
+	})
+
+	t.Run("Classification", func(t *testing.T) {
+		p := crudp.DefaultRetryPolicy()
+		if !p.ShouldRetry(1, 503, nil) {
+			t.Error("expected 503 to be retried")
+		}
+		if !p.ShouldRetry(1, 0, Err("network down")) {
+			t.Error("expected network error to be retried")
+		}
+		if p.ShouldRetry(1, 400, nil) {
+			t.Error("expected 400 not to be retried")
+		}
+		if p.ShouldRetry(p.MaxAttempts, 503, nil) {
+			t.Error("expected no retry after the last attempt")
+		}
+	})
+
+	t.Run("Creates Need Idempotency Key", func(t *testing.T) {
+		if crudp.IsRetrySafe(&crudp.Packet{Action: 'c'}) {
+			t.Error("create without key must not be retry safe")
+		}
+		if !crudp.IsRetrySafe(&crudp.Packet{Action: 'c', IdempotencyKey: "k1"}) {
+			t.Error("create with key must be retry safe")
+		}
+		if !crudp.IsRetrySafe(&crudp.Packet{Action: 'u'}) {
+			t.Error("update must be retry safe")
+		}
+	})
+}
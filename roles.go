@@ -0,0 +1,88 @@
+package crudp
+
+// SetRoleHierarchy defines roles that imply other roles, e.g.
+// {'a': {'e'}, 'e': {'v'}}: admins are also editors, editors also visitors.
+// Inheritance is transitive and resolved at check time; set it before
+// RegisterHandlers, which rejects cycles.
+func (cp *CrudP) SetRoleHierarchy(hierarchy map[byte][]byte) {
+	cp.roleHierarchy = hierarchy
+}
+
+// effectiveRoles returns userRoles followed by every role they imply
+func (cp *CrudP) effectiveRoles(userRoles []byte) []byte {
+	if len(cp.roleHierarchy) == 0 || len(userRoles) == 0 {
+		return userRoles
+	}
+
+	var seen [256]bool
+	roles := make([]byte, 0, len(userRoles)*2)
+	for _, r := range userRoles {
+		if !seen[r] {
+			seen[r] = true
+			roles = append(roles, r)
+		}
+	}
+	for i := 0; i < len(roles); i++ {
+		for _, implied := range cp.roleHierarchy[roles[i]] {
+			if !seen[implied] {
+				seen[implied] = true
+				roles = append(roles, implied)
+			}
+		}
+	}
+	return roles
+}
+
+// checkRoleHierarchy returns an error naming the first cycle found
+func (cp *CrudP) checkRoleHierarchy() error {
+	// 0 = unvisited, 1 = on the current path, 2 = done
+	var state [256]uint8
+	var path []byte
+
+	var visit func(r byte) error
+	visit = func(r byte) error {
+		path = append(path, r)
+		switch state[r] {
+		case 1:
+			start := 0
+			for path[start] != r {
+				start++
+			}
+			return errorf("security error: role hierarchy has a cycle: %s", rolePath(path[start:]))
+		case 2:
+			path = path[:len(path)-1]
+			return nil
+		}
+		state[r] = 1
+		for _, implied := range cp.roleHierarchy[r] {
+			if err := visit(implied); err != nil {
+				return err
+			}
+		}
+		state[r] = 2
+		path = path[:len(path)-1]
+		return nil
+	}
+
+	// Visit in byte order so the reported cycle is deterministic
+	for r := 0; r < 256; r++ {
+		if _, ok := cp.roleHierarchy[byte(r)]; ok {
+			if err := visit(byte(r)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rolePath formats roles as 'a' -> 'e' -> 'a'
+func rolePath(roles []byte) string {
+	out := ""
+	for i, r := range roles {
+		if i > 0 {
+			out += " -> "
+		}
+		out += "'" + string(r) + "'"
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// CookieSession keeps the identity in an HMAC-signed cookie. The cookie is
+// not encrypted: user id and roles are readable but cannot be forged.
+type CookieSession struct {
+	Name     string // Cookie name, "crudp_session" by default
+	Secret   []byte
+	MaxAge   time.Duration // Session lifetime, 24h by default
+	Insecure bool          // Allow the cookie over plain HTTP (development only)
+}
+
+type sessionClaims struct {
+	UserID  string `json:"u"`
+	Roles   string `json:"r"`
+	Expires int64  `json:"e"`
+}
+
+func (s *CookieSession) name() string {
+	if s.Name == "" {
+		return "crudp_session"
+	}
+	return s.Name
+}
+
+func (s *CookieSession) maxAge() time.Duration {
+	if s.MaxAge <= 0 {
+		return 24 * time.Hour
+	}
+	return s.MaxAge
+}
+
+// Issue starts a session for id, e.g. from a login handler
+func (s *CookieSession) Issue(w http.ResponseWriter, id Identity) error {
+	if len(s.Secret) == 0 {
+		return Errf("session secret not configured")
+	}
+	expires := time.Now().Add(s.maxAge())
+	payload, err := json.Marshal(sessionClaims{UserID: id.UserID, Roles: string(id.Roles), Expires: expires.Unix()})
+	if err != nil {
+		return err
+	}
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	value += "." + base64.RawURLEncoding.EncodeToString(s.sign(value))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.name(),
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   !s.Insecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Clear ends the session
+func (s *CookieSession) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.name(),
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   !s.Insecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Authenticate implements Authenticator
+func (s *CookieSession) Authenticate(r *http.Request) (*Identity, error) {
+	cookie, err := r.Cookie(s.name())
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+	if len(s.Secret) == 0 {
+		return nil, Errf("session secret not configured")
+	}
+
+	parts := Split(cookie.Value, ".")
+	if len(parts) != 2 {
+		return nil, Errf("invalid session")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, s.sign(parts[0])) {
+		return nil, Errf("invalid session signature")
+	}
+
+	var claims sessionClaims
+	if raw, err := base64.RawURLEncoding.DecodeString(parts[0]); err != nil || json.Unmarshal(raw, &claims) != nil {
+		return nil, Errf("invalid session")
+	}
+	if time.Now().Unix() >= claims.Expires {
+		return nil, Errf("session expired")
+	}
+	if claims.UserID == "" {
+		return nil, Errf("invalid session: no user id")
+	}
+	return &Identity{UserID: claims.UserID, Roles: []byte(claims.Roles)}, nil
+}
+
+func (s *CookieSession) sign(value string) []byte {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
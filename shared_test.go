@@ -3,7 +3,6 @@ package crudp_test
 import (
 	"encoding/json"
 
-	tjson "github.com/tinywasm/json"
 	"github.com/tinywasm/crudp"
 )
 
@@ -15,11 +14,11 @@ func NewTestCrudP() *crudp.CrudP {
 }
 
 func testEncodeJSON2(input any, output any) error {
-	return tjson.Encode(input, output)
+	return jsonEncode(input, output)
 }
 
 func testDecodeJSON2(input any, output any) error {
-	return tjson.Decode(input.([]byte), output)
+	return jsonDecode(input, output)
 }
 
 func NewTestCrudPJSON() *crudp.CrudP {
@@ -31,12 +30,12 @@ func NewTestCrudPJSON() *crudp.CrudP {
 
 func testEncodeBinary(data any) ([]byte, error) {
 	var out []byte
-	err := tjson.Encode(data, &out)
+	err := jsonEncode(data, &out)
 	return out, err
 }
 
 func testDecodeBinary(data []byte, target any) error {
-	return tjson.Decode(data, target)
+	return jsonDecode(data, target)
 }
 
 func testEncodeJSON(data any) ([]byte, error) {
@@ -0,0 +1,67 @@
+package crudp
+
+import (
+	. "github.com/tinywasm/fmt"
+)
+
+// streamFrameItems is the number of encoded items sent per stream frame
+const streamFrameItems = 100
+
+// streamSink receives the items of a streamed List. It travels in
+// CallHandler data; dispatch hands it to StreamList instead of calling List.
+type streamSink func(item any) bool
+
+func sinkFrom(data []any) streamSink {
+	for _, d := range data {
+		if s, ok := d.(streamSink); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// canStream reports whether a read packet lists a handler implementing StreamLister
+func (cp *CrudP) canStream(p *Packet) bool {
+	return p.Action == 'r' && len(p.Data) == 0 && int(p.HandlerID) < len(cp.handlers) &&
+		cp.handlers[p.HandlerID].StreamList != nil
+}
+
+// streamList runs a handler's StreamList through CallHandler (access checks
+// and validation included), encoding items with c. Every streamFrameItems
+// items are passed to frame; a false return stops the listing. The items of
+// the last, incomplete frame are returned.
+func (cp *CrudP) streamList(handlerID uint8, c Codec, frame func(items [][]byte) bool, data ...any) ([][]byte, error) {
+	if c.Encode == nil {
+		return nil, Errf("encode function not configured")
+	}
+
+	var items [][]byte
+	var encodeErr error
+	stopped := false
+	sink := streamSink(func(item any) bool {
+		if stopped {
+			return false
+		}
+		var encoded []byte
+		if err := c.Encode(item, &encoded); err != nil {
+			encodeErr = err
+			stopped = true
+			return false
+		}
+		items = append(items, encoded)
+		if len(items) == streamFrameItems {
+			stopped = !frame(items)
+			items = nil
+		}
+		return !stopped
+	})
+
+	call := append(append(make([]any, 0, len(data)+2), data...), c, sink)
+	if _, err := cp.CallHandler(handlerID, 'r', call...); err != nil {
+		return nil, err
+	}
+	if encodeErr != nil {
+		return nil, encodeErr
+	}
+	return items, nil
+}
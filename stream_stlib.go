@@ -0,0 +1,121 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"net/http"
+
+	"github.com/tinywasm/context"
+	. "github.com/tinywasm/fmt"
+)
+
+// MIMENDJSON selects the streaming response mode: one encoded Response
+// (automatic endpoints) or PacketResult (/batch) per line. Requires a codec
+// whose output has no newlines, such as JSON.
+const MIMENDJSON = "application/x-ndjson"
+
+// acceptsStream reports whether an Accept value asks for MIMENDJSON
+func acceptsStream(accept string) bool {
+	for _, mime := range mediaTypes(accept) {
+		if mime == MIMENDJSON {
+			return true
+		}
+	}
+	return false
+}
+
+// frameWriter writes one encoded frame per line and flushes it, until the
+// client disconnects or a write fails
+type frameWriter struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	c       Codec
+	started bool
+	failed  bool
+}
+
+func (fw *frameWriter) write(frame any) bool {
+	if fw.failed || fw.r.Context().Err() != nil {
+		fw.failed = true
+		return false
+	}
+
+	var encoded []byte
+	if err := fw.c.Encode(frame, &encoded); err != nil {
+		fw.failed = true
+		return false
+	}
+	if !fw.started {
+		fw.w.Header().Set("Content-Type", MIMENDJSON)
+		fw.w.Header().Set("X-Content-Type-Options", "nosniff")
+		fw.started = true
+	}
+	if _, err := fw.w.Write(append(encoded, '\n')); err != nil {
+		fw.failed = true
+		return false
+	}
+	if flusher, ok := fw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return true
+}
+
+// handleStreamSingle streams GET /{handler}/ for a StreamLister. Partial
+// frames carry Status 206; the last frame carries the final outcome.
+func (cp *CrudP) handleStreamSingle(w http.ResponseWriter, r *http.Request, ctx *context.Context, h actionHandler, c Codec, reqID string) {
+	fw := &frameWriter{w: w, r: r, c: c}
+
+	rest, err := cp.streamList(h.index, c, func(items [][]byte) bool {
+		return fw.write(Response{ReqID: reqID, Data: items, MessageType: uint8(Msg.Success), Message: "partial", Status: 206})
+	}, ctx, r)
+
+	if fw.failed {
+		cp.log("stream aborted for handler:", h.name)
+		return
+	}
+	last := Response{ReqID: reqID, Data: rest, MessageType: uint8(Msg.Success), Message: "OK"}
+	if err != nil {
+		pr := PacketResult{}
+		cp.setError(&pr, err, c)
+		last = Response{ReqID: reqID, MessageType: pr.MessageType, Message: pr.Message, Status: pr.Status}
+	}
+	fw.write(last)
+}
+
+// handleStreamBatch executes a batch writing each result as soon as it is
+// ready. List packets of StreamLister handlers are split into partial
+// results (Status 206) followed by a final result.
+func (cp *CrudP) handleStreamBatch(w http.ResponseWriter, r *http.Request, ctx *context.Context, req *BatchRequest, c activeCodec) {
+	fw := &frameWriter{w: w, r: r, c: c.out}
+
+	for _, p := range req.Packets {
+		if fw.failed {
+			cp.log("stream aborted before", p.ReqID)
+			return
+		}
+
+		if !cp.canStream(&p) {
+			resp, _ := cp.Execute(&BatchRequest{Packets: []Packet{p}}, ctx, r, c)
+			for _, res := range resp.Results {
+				fw.write(res)
+			}
+			continue
+		}
+
+		rest, err := cp.streamList(p.HandlerID, c.out, func(items [][]byte) bool {
+			partial := PacketResult{Packet: p, MessageType: uint8(Msg.Success), Message: "partial", Status: 206}
+			partial.Data = items
+			return fw.write(partial)
+		}, ctx, r)
+
+		last := PacketResult{Packet: p}
+		if err != nil {
+			cp.setError(&last, err, c.out)
+		} else {
+			last.Data = rest
+			last.MessageType = uint8(Msg.Success)
+			last.Message = "OK"
+		}
+		fw.write(last)
+	}
+}
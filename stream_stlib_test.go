@@ -0,0 +1,168 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/crudp"
+)
+
+type Row struct {
+	N int `json:"n"`
+}
+
+// rowCount is the number of rows StreamList yields (< 0 = until stopped)
+var rowCount int
+
+// rowsStopped receives whether StreamList ended because yield returned false
+var rowsStopped chan bool
+
+func (r *Row) HandlerName() string             { return "rows" }
+func (r *Row) Read(id string) (any, error)     { return &Row{}, nil }
+func (r *Row) List() (any, error)              { return []*Row{{N: 1}}, nil }
+func (r *Row) ValidateData(byte, any) error    { return nil }
+func (r *Row) AllowedRoles(action byte) []byte { return []byte{'*'} }
+func (r *Row) StreamList(yield func(item any) bool) error {
+	for i := 0; rowCount < 0 || i < rowCount; i++ {
+		if !yield(&Row{N: i}) {
+			rowsStopped <- true
+			return nil
+		}
+	}
+	rowsStopped <- false
+	return nil
+}
+
+func newRowServer(t *testing.T, count int) *http.ServeMux {
+	rowCount = count
+	rowsStopped = make(chan bool, 1)
+	cp := NewTestCrudP()
+	if err := cp.RegisterHandlers(&Row{}, &Doc{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	docStore = map[string]*Doc{"1": {ID: "1", Rev: 1}}
+	mux := http.NewServeMux()
+	cp.RegisterRoutes(mux)
+	return mux
+}
+
+func ndjsonLines(t *testing.T, body string) []string {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		t.Fatal("empty stream")
+	}
+	return lines
+}
+
+func TestStreamList(t *testing.T) {
+	t.Run("GET Frames", func(t *testing.T) {
+		mux := newRowServer(t, 250)
+
+		req := httptest.NewRequest("GET", "/rows/", nil)
+		req.Header.Set("Accept", crudp.MIMENDJSON)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if ct := rec.Header().Get("Content-Type"); ct != crudp.MIMENDJSON {
+			t.Fatalf("expected %s, got %q", crudp.MIMENDJSON, ct)
+		}
+		lines := ndjsonLines(t, rec.Body.String())
+		if len(lines) != 3 {
+			t.Fatalf("expected 3 frames, got %d", len(lines))
+		}
+		total := 0
+		for i, line := range lines {
+			var frame crudp.Response
+			if err := jsonDecode([]byte(line), &frame); err != nil {
+				t.Fatalf("frame %d: %v", i, err)
+			}
+			total += len(frame.Data)
+			if last := i == len(lines)-1; (frame.Status == 206) == last {
+				t.Errorf("frame %d: unexpected status %d", i, frame.Status)
+			}
+		}
+		if total != 250 {
+			t.Errorf("expected 250 items, got %d", total)
+		}
+
+		// Without the streaming Accept, List is used
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/rows/", nil))
+		var resp crudp.Response
+		if err := jsonDecode(rec.Body.Bytes(), &resp); err != nil || len(resp.Data) != 1 {
+			t.Errorf("expected List response, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("Batch Frames", func(t *testing.T) {
+		mux := newRowServer(t, 120)
+
+		var body []byte
+		jsonEncode(crudp.BatchRequest{Packets: []crudp.Packet{
+			{Action: 'r', HandlerID: 0, ReqID: "list"},
+			{Action: 'd', HandlerID: 1, ReqID: "del", Data: [][]byte{[]byte("1")}},
+		}}, &body)
+		req := httptest.NewRequest("POST", "/batch", httpBodyFromBytes(body))
+		req.Header.Set("Accept", crudp.MIMENDJSON)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		lines := ndjsonLines(t, rec.Body.String())
+		var results []crudp.PacketResult
+		for _, line := range lines {
+			var res crudp.PacketResult
+			if err := jsonDecode([]byte(line), &res); err != nil {
+				t.Fatal(err)
+			}
+			results = append(results, res)
+		}
+		if len(results) != 3 {
+			t.Fatalf("expected 3 results, got %d: %s", len(results), rec.Body.String())
+		}
+		if r := results[0]; r.ReqID != "list" || r.Status != 206 || len(r.Data) != 100 {
+			t.Errorf("unexpected partial result: %s %d %d", r.ReqID, r.Status, len(r.Data))
+		}
+		if r := results[1]; r.ReqID != "list" || r.Status != 0 || len(r.Data) != 20 || r.Message != "OK" {
+			t.Errorf("unexpected final result: %s %d %d", r.ReqID, r.Status, len(r.Data))
+		}
+		if r := results[2]; r.ReqID != "del" || r.MessageType != 4 {
+			t.Errorf("unexpected delete result: %+v", r)
+		}
+	})
+
+	t.Run("Stops On Disconnect", func(t *testing.T) {
+		mux := newRowServer(t, -1)
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/rows/", nil)
+		req.Header.Set("Accept", crudp.MIMENDJSON)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+			t.Fatalf("expected a first frame: %v", err)
+		}
+		cancel()
+		resp.Body.Close()
+
+		select {
+		case stopped := <-rowsStopped:
+			if !stopped {
+				t.Error("StreamList should have been stopped by yield")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("StreamList kept running after the client disconnected")
+		}
+	})
+}
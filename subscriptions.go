@@ -0,0 +1,188 @@
+package crudp
+
+import (
+	. "github.com/tinywasm/fmt"
+)
+
+// ConnHeader carries the client's push connection id on /batch requests
+const ConnHeader = "X-Crudp-Conn"
+
+// Pusher delivers server-initiated batch responses to a client connection
+// (SSE, WebSocket...). Implementations must be safe for concurrent use.
+type Pusher interface {
+	Push(connID string, resp *BatchResponse) error
+}
+
+// subscription is a live interest of a connection in a handler's
+// resources (id == "" means every entity of the handler)
+type subscription struct {
+	handlerID uint8
+	id        string
+	userID    string
+	roles     []byte // Roles as resolved when subscribing, before the hierarchy
+	tenant    string
+}
+
+// SetPusher enables real-time subscriptions. connID extracts the client
+// connection id from the request data (same variadic as SetUserRoles);
+// create/update/delete results matching a connection's subscriptions are
+// pushed to it through pusher.
+func (cp *CrudP) SetPusher(pusher Pusher, connID func(data ...any) string) {
+	cp.pusher = pusher
+	cp.getConnID = connID
+}
+
+// DropConnection removes every subscription of a connection. Pushers call
+// it when the client disconnects.
+func (cp *CrudP) DropConnection(connID string) {
+	cp.subsMu.Lock()
+	defer cp.subsMu.Unlock()
+	delete(cp.subs, connID)
+}
+
+func (cp *CrudP) hasSubscriptions() bool {
+	cp.subsMu.Lock()
+	defer cp.subsMu.Unlock()
+	return len(cp.subs) > 0
+}
+
+// executeSubscription handles subscribe ('+') and unsubscribe ('-') packets.
+// Data optionally carries the entity id to scope the subscription.
+func (cp *CrudP) executeSubscription(p *Packet, entry *AuditEntry, inject ...any) (PacketResult, error) {
+	pr := PacketResult{Packet: *p}
+	codec := cp.codecFrom(inject).out
+	fail := func(err error) (PacketResult, error) {
+		cp.setError(&pr, err, codec)
+		return pr, err
+	}
+
+	if cp.pusher == nil || cp.getConnID == nil {
+		return fail(Errf("subscriptions require a pusher"))
+	}
+	connID := cp.getConnID(inject...)
+	if connID == "" {
+		return fail(&StatusError{Code: 400, Message: "missing connection id"})
+	}
+	if int(p.HandlerID) >= len(cp.handlers) {
+		return fail(errorf("no handler found for id: %d", p.HandlerID))
+	}
+	handler := cp.handlers[p.HandlerID]
+
+	tenant, err := cp.admit(handler, p.Action, entry, inject...)
+	if err != nil {
+		return fail(err)
+	}
+	sub := subscription{handlerID: p.HandlerID, tenant: tenant}
+	if len(p.Data) > 0 {
+		sub.id = string(p.Data[0])
+	}
+	if cp.getUserID != nil {
+		sub.userID = cp.getUserID(inject...)
+	}
+	if cp.getUserRoles != nil {
+		sub.roles = cp.getUserRoles(inject...)
+	}
+
+	cp.subsMu.Lock()
+	if cp.subs == nil {
+		cp.subs = make(map[string][]subscription)
+	}
+	current := cp.subs[connID]
+	kept := current[:0]
+	for _, s := range current {
+		if s.handlerID != sub.handlerID || s.id != sub.id {
+			kept = append(kept, s)
+		}
+	}
+	if p.Action == '+' {
+		kept = append(kept, sub)
+	}
+	if len(kept) == 0 {
+		delete(cp.subs, connID)
+	} else {
+		cp.subs[connID] = kept
+	}
+	cp.subsMu.Unlock()
+
+	pr.MessageType = uint8(Msg.Success)
+	pr.Message = "OK"
+	return pr, nil
+}
+
+// publish pushes a successful mutation to every connection of the same
+// tenant subscribed to the handler (or to the entity id) whose roles still
+// grant 'r' access. encoded is the entity (nil for deletes, which carry the
+// id instead).
+func (cp *CrudP) publish(handler actionHandler, action byte, id, tenant string, encoded []byte) {
+	if cp.pusher == nil {
+		return
+	}
+
+	// Access checks may call user code: run them outside of subsMu
+	matches := make(map[string][]subscription)
+	cp.subsMu.Lock()
+	for connID, subs := range cp.subs {
+		for _, s := range subs {
+			if s.handlerID == handler.index && (tenant == "" || s.tenant == tenant) && (s.id == "" || s.id == id) {
+				matches[connID] = append(matches[connID], s)
+			}
+		}
+	}
+	cp.subsMu.Unlock()
+
+	for connID, subs := range matches {
+		for _, s := range subs {
+			if !cp.canPush(handler, s) {
+				continue
+			}
+			data, ok := cp.pushPolicy(handler, s).change(action, id, encoded)
+			if !ok {
+				continue
+			}
+			if action == 'd' {
+				data = []byte(id)
+			}
+			result := PacketResult{
+				Packet:      Packet{Action: action, HandlerID: handler.index, Data: [][]byte{data}},
+				MessageType: uint8(Msg.Success),
+				Message:     "OK",
+			}
+			if err := cp.pusher.Push(connID, &BatchResponse{Results: []PacketResult{result}}); err != nil {
+				cp.log("push failed for connection:", connID, err)
+			}
+			break
+		}
+	}
+}
+
+// pushPolicy binds handler's policies to the identity captured at subscribe
+// time
+func (cp *CrudP) pushPolicy(handler actionHandler, s subscription) *callPolicy {
+	p := cp.newPolicy(handler, s.tenant)
+	if p != nil {
+		p.userID = s.userID
+		p.roles = cp.effectiveRoles(s.roles)
+	}
+	return p
+}
+
+// canPush re-evaluates 'r' access with the identity captured at subscribe
+// time. The request is gone, so the policies and the external check receive
+// a context holding the subscriber's UserIDKey, RolesKey and TenantKey.
+func (cp *CrudP) canPush(handler actionHandler, s subscription) bool {
+	if cp.devMode {
+		return true
+	}
+	data := callerData(s.userID, s.roles, s.tenant, nil)
+	roles := cp.effectiveRoles(s.roles)
+	switch {
+	case cp.policies != nil:
+		allowed, _, _ := cp.policies.decide(cp.accessRequest(handler, 'r', s.userID, roles, data...))
+		return allowed
+	case cp.accessCheckFn != nil:
+		return cp.accessCheckFn(handler.name, 'r', data...)
+	case handler.AllowedRoles == nil || cp.getUserRoles == nil:
+		return true
+	}
+	return hasAnyRole(roles, handler.AllowedRoles('r'))
+}
@@ -0,0 +1,180 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/context"
+	"github.com/tinywasm/crudp"
+)
+
+type fakePusher struct {
+	mu     sync.Mutex
+	pushed map[string][]crudp.PacketResult
+}
+
+func (f *fakePusher) Push(connID string, resp *crudp.BatchResponse) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pushed[connID] = append(f.pushed[connID], resp.Results...)
+	return nil
+}
+
+func connRequest(connID string) *http.Request {
+	r := httptest.NewRequest("POST", "/batch", nil)
+	r.Header.Set(crudp.ConnHeader, connID)
+	return r
+}
+
+func TestSubscriptions(t *testing.T) {
+	t.Run("Push To Matching Subscriptions", func(t *testing.T) {
+		cp, _ := newDocServer(t)
+		pusher := &fakePusher{pushed: map[string][]crudp.PacketResult{}}
+		cp.SetPusher(pusher, crudp.NewSSEPusher(cp).ConnID)
+
+		resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: '+', ReqID: "s1"}}}, connRequest("all"))
+		if res := resp.Results[0]; res.Action != '+' || res.Message != "OK" {
+			t.Fatalf("subscribe failed: %+v", res)
+		}
+		cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: '+', ReqID: "s2", Data: [][]byte{[]byte("2")}}}}, connRequest("one"))
+
+		var data []byte
+		jsonEncode(&Doc{ID: "1", Rev: 3, Txt: "edit"}, &data)
+		cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'u', ReqID: "u1", Data: [][]byte{data}}}})
+		cp.CallHandler(0, 'd', "1")
+
+		all := pusher.pushed["all"]
+		if len(all) != 2 || all[0].Action != 'u' || all[1].Action != 'd' || string(all[1].Data[0]) != "1" {
+			t.Fatalf("unexpected pushes: %+v", all)
+		}
+		var doc Doc
+		if err := jsonDecode(all[0].Data[0], &doc); err != nil || doc.Rev != 4 || doc.Txt != "edit" {
+			t.Errorf("expected pushed entity at rev 4, got %+v (%v)", doc, err)
+		}
+		if len(pusher.pushed["one"]) != 0 {
+			t.Errorf("entity subscription received changes of another id: %+v", pusher.pushed["one"])
+		}
+	})
+
+	t.Run("Unsubscribe And Drop", func(t *testing.T) {
+		cp, _ := newDocServer(t)
+		pusher := &fakePusher{pushed: map[string][]crudp.PacketResult{}}
+		cp.SetPusher(pusher, crudp.NewSSEPusher(cp).ConnID)
+
+		cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: '+', ReqID: "s1"}}}, connRequest("a"))
+		cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: '+', ReqID: "s2"}}}, connRequest("b"))
+		cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: '-', ReqID: "s3"}}}, connRequest("a"))
+		cp.DropConnection("b")
+
+		cp.CallHandler(0, 'd', "1")
+		if len(pusher.pushed) != 0 {
+			t.Errorf("expected no pushes, got %+v", pusher.pushed)
+		}
+	})
+
+	t.Run("Access Re-Checked On Push", func(t *testing.T) {
+		cp, _ := newDocServer(t)
+		cp.SetDevMode(false)
+		pusher := &fakePusher{pushed: map[string][]crudp.PacketResult{}}
+		cp.SetPusher(pusher, crudp.NewSSEPusher(cp).ConnID)
+		cp.SetUserID(crudp.ContextUserID)
+		revoked := map[string]bool{}
+		cp.SetAccessCheck(func(resource string, action byte, data ...any) bool {
+			return !revoked[crudp.ContextUserID(data...)]
+		})
+
+		ctx := context.Background()
+		ctx.Set(crudp.UserIDKey, "ana")
+		resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: '+', ReqID: "s1"}}}, ctx, connRequest("ana"))
+		if res := resp.Results[0]; res.Message != "OK" {
+			t.Fatalf("subscribe failed: %+v", res)
+		}
+
+		cp.CallHandler(0, 'd', "1")
+		if len(pusher.pushed["ana"]) != 1 {
+			t.Fatalf("expected one push, got %+v", pusher.pushed["ana"])
+		}
+
+		revoked["ana"] = true
+		docStore["1"] = &Doc{ID: "1", Rev: 3}
+		cp.CallHandler(0, 'd', "1")
+		if len(pusher.pushed["ana"]) != 1 {
+			t.Errorf("expected no push after access was revoked, got %+v", pusher.pushed["ana"])
+		}
+	})
+
+	t.Run("Missing Connection", func(t *testing.T) {
+		cp, _ := newDocServer(t)
+		cp.SetPusher(&fakePusher{pushed: map[string][]crudp.PacketResult{}}, crudp.NewSSEPusher(cp).ConnID)
+
+		resp, _ := cp.Execute(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: '+', ReqID: "s1"}}})
+		if res := resp.Results[0]; res.Status != 400 {
+			t.Errorf("expected 400, got %+v", res)
+		}
+	})
+}
+
+func TestSSEPusher(t *testing.T) {
+	cp, mux := newDocServer(t)
+	sse := crudp.NewSSEPusher(cp)
+	cp.SetPusher(sse, sse.ConnID)
+	mux.Handle("GET /events", sse)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	stream, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("GET /events failed: %v", err)
+	}
+	defer stream.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(stream.Body)
+		for scanner.Scan() {
+			if line, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				lines <- line
+			}
+		}
+		close(lines)
+	}()
+
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for event")
+			return ""
+		}
+	}
+
+	connID := next()
+	var body []byte
+	jsonEncode(&crudp.BatchRequest{Packets: []crudp.Packet{{Action: '+', ReqID: "s1"}}}, &body)
+	req, _ := http.NewRequest("POST", server.URL+"/batch", strings.NewReader(string(body)))
+	req.Header.Set(crudp.ConnHeader, connID)
+	if resp, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	cp.CallHandler(0, 'd', "1")
+
+	var pushed crudp.BatchResponse
+	if err := jsonDecode([]byte(next()), &pushed); err != nil {
+		t.Fatalf("failed to decode pushed response: %v", err)
+	}
+	if len(pushed.Results) != 1 || pushed.Results[0].Action != 'd' || string(pushed.Results[0].Data[0]) != "1" {
+		t.Errorf("unexpected pushed response: %+v", pushed)
+	}
+}
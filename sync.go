@@ -0,0 +1,140 @@
+package crudp
+
+import (
+	. "github.com/tinywasm/fmt"
+)
+
+// executeSync answers a sync packet ('s') with the changes of its handler
+// since p.Cursor, collapsed to the latest state of each entity:
+//   - 'c'/'u' results carry the encoded entity in Data
+//   - 'd' results are tombstones carrying the entity id in Data
+//
+// A final 's' result carries the new Cursor for the client to store. The
+// error, if any, is the one reported in the results.
+func (cp *CrudP) executeSync(p *Packet, entry *AuditEntry, inject ...any) ([]PacketResult, error) {
+	fail := func(err error) ([]PacketResult, error) {
+		pr := PacketResult{Packet: *p}
+		cp.setError(&pr, err, cp.defaultCodec())
+		return []PacketResult{pr}, err
+	}
+
+	if cp.changeLog == nil {
+		return fail(Errf("sync requires a change log"))
+	}
+	if int(p.HandlerID) >= len(cp.handlers) {
+		return fail(errorf("no handler found for id: %d", p.HandlerID))
+	}
+	handler := cp.handlers[p.HandlerID]
+
+	tenant, err := cp.admit(handler, p.Action, entry, inject...)
+	if err != nil {
+		return fail(err)
+	}
+
+	changes, err := cp.changeLog.Since(p.Cursor, 0)
+	if expired, ok := err.(*CursorExpiredError); ok {
+		return cp.expiredSync(p, expired), expired
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	cursor := p.Cursor
+	var order []string            // entity ids in order of last change
+	latest := map[string]Change{} // last change per id
+	created := map[string]bool{}  // ids created after the cursor
+	var anonymous []Change        // changes without id cannot be collapsed
+
+	for _, c := range changes {
+		cursor = c.Seq
+		if c.Handler != handler.name || (c.Tenant != "" && c.Tenant != tenant) {
+			continue
+		}
+		if c.ID == "" {
+			anonymous = append(anonymous, c)
+			continue
+		}
+		if c.Action == 'c' {
+			created[c.ID] = true
+		}
+		if _, seen := latest[c.ID]; seen {
+			for i, id := range order {
+				if id == c.ID {
+					order = append(order[:i], order[i+1:]...)
+					break
+				}
+			}
+		}
+		latest[c.ID] = c
+		order = append(order, c.ID)
+	}
+
+	codec := cp.codecFrom(inject).out
+	policy := cp.policyFor(handler, tenant, inject...)
+	results := make([]PacketResult, 0, len(order)+len(anonymous)+1)
+	emit := func(action byte, id string, data []byte) {
+		out, ok := policy.change(action, id, data)
+		switch {
+		case ok && action == 'd':
+			data = []byte(id)
+		case ok:
+			encoded, err := cp.transcode(handler, out, codec)
+			if err != nil {
+				cp.log("sync transcode failed for handler:", handler.name, err)
+				return
+			}
+			data = encoded
+		case action == 'u' && id != "":
+			// An entity the client may no longer read is removed from it
+			action, data = 'd', []byte(id)
+		default:
+			return
+		}
+		pr := PacketResult{
+			Packet:      Packet{Action: action, HandlerID: p.HandlerID, ReqID: p.ReqID, Data: [][]byte{data}},
+			MessageType: uint8(Msg.Success),
+			Message:     "OK",
+		}
+		results = append(results, pr)
+	}
+
+	for _, c := range anonymous {
+		if c.Action != 'd' {
+			emit(c.Action, "", c.Data)
+		}
+	}
+	for _, id := range order {
+		c := latest[id]
+		switch {
+		case c.Action == 'd' && created[id]:
+			// Created and deleted while the client was away: nothing to report
+		case c.Action == 'd':
+			emit('d', id, c.Data)
+		case created[id]:
+			emit('c', id, c.Data)
+		default:
+			emit('u', id, c.Data)
+		}
+	}
+
+	done := PacketResult{
+		Packet:      Packet{Action: 's', HandlerID: p.HandlerID, ReqID: p.ReqID, Cursor: cursor},
+		MessageType: uint8(Msg.Success),
+		Message:     "OK",
+	}
+	return append(results, done), nil
+}
+
+// expiredSync answers a sync whose cursor is older than the change log
+// (status 410). The result carries the latest cursor: the client reloads
+// the handler with List and continues from there.
+func (cp *CrudP) expiredSync(p *Packet, expired *CursorExpiredError) []PacketResult {
+	pr := PacketResult{Packet: Packet{Action: 's', HandlerID: p.HandlerID, ReqID: p.ReqID}}
+	cp.setError(&pr, expired, cp.defaultCodec())
+
+	pr.Cursor = expired.Oldest - 1
+	if changes, err := cp.changeLog.Since(pr.Cursor, 0); err == nil && len(changes) > 0 {
+		pr.Cursor = changes[len(changes)-1].Seq
+	}
+	return []PacketResult{pr}
+}
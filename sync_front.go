@@ -0,0 +1,59 @@
+//go:build wasm
+
+package crudp
+
+import (
+	. "github.com/tinywasm/fmt"
+)
+
+// Sync asks the server for every change since the last one seen, for all
+// registered CRUD handlers. Results flow through HandleResponse: entities
+// reach Create/Update, tombstones reach Delete, and the cursors advance.
+func (cp *CrudP) Sync() {
+	req := &BatchRequest{}
+	for _, h := range cp.handlers {
+		if h.name == "" {
+			continue
+		}
+		req.Packets = append(req.Packets, Packet{
+			Action:    's',
+			HandlerID: h.index,
+			ReqID:     Sprintf("sync-%d", h.index),
+			Cursor:    cp.SyncCursor(h.index),
+		})
+	}
+	cp.Send(req)
+}
+
+// SyncCursor returns the last change sequence seen for a handler.
+func (cp *CrudP) SyncCursor(handlerID uint8) uint64 {
+	cp.clientMu.Lock()
+	defer cp.clientMu.Unlock()
+	return cp.syncCursors[handlerID]
+}
+
+// SetSyncCursor sets the last change sequence seen for a handler, e.g. to
+// restore cursors persisted in localStorage before calling Sync.
+func (cp *CrudP) SetSyncCursor(handlerID uint8, seq uint64) {
+	cp.clientMu.Lock()
+	defer cp.clientMu.Unlock()
+
+	if cp.syncCursors == nil {
+		cp.syncCursors = make(map[uint8]uint64)
+	}
+	cp.syncCursors[handlerID] = seq
+}
+
+// resync reloads a handler whose cursor expired on the server: the List
+// result flows through HandleResponse like any read, then syncing goes on
+// from cursor.
+func (cp *CrudP) resync(handlerID uint8, cursor uint64) {
+	cp.log("sync cursor expired, reloading handler:", cp.GetHandlerName(handlerID))
+	cp.SetSyncCursor(handlerID, cursor)
+	cp.InvalidateCache(handlerID)
+	cp.Send(&BatchRequest{Packets: []Packet{{
+		Action:    'r',
+		HandlerID: handlerID,
+		ReqID:     Sprintf("resync-%d", handlerID),
+	}}})
+}
@@ -0,0 +1,100 @@
+package crudp
+
+// TenantKey is the context key holding the tenant of a request
+const TenantKey = "crudp.tenant"
+
+// SetTenantResolver enables multi-tenancy. fn returns the caller's tenant
+// from the request data (same data as SetUserRoles: header, subdomain,
+// token...). The HTTP layer stores it under TenantKey in the injected
+// context. Handlers implementing TenantHandler or TenantOwned then require a
+// tenant and never serve another tenant's entities. The caller must also pass
+// SetTenantAuthorizer.
+func (cp *CrudP) SetTenantResolver(fn func(data ...any) string) {
+	cp.getTenant = fn
+}
+
+// SetTenantAuthorizer sets the membership check of multi-tenancy. The
+// resolver reads a tenant the client chose (header, subdomain), so before a
+// scoped handler, the change feed, sync or a subscription serves a tenant,
+// fn must confirm that the caller (SetUserID) belongs to it. Without fn,
+// every tenant is refused outside of dev mode.
+func (cp *CrudP) SetTenantAuthorizer(fn func(userID, tenant string) bool) {
+	cp.tenantMember = fn
+}
+
+// authorizeTenant refuses callers that do not belong to tenant (403)
+func (cp *CrudP) authorizeTenant(tenant string, data ...any) error {
+	if tenant == "" || cp.devMode {
+		return nil
+	}
+	var userID string
+	if cp.getUserID != nil {
+		userID = cp.getUserID(data...)
+	}
+	if cp.tenantMember == nil || !cp.tenantMember(userID, tenant) {
+		cp.log("tenant access denied for user:", userID, "tenant:", tenant)
+		return &StatusError{Code: 403, Message: "tenant access denied"}
+	}
+	return nil
+}
+
+// changeTenant is the tenant recorded with a change: the caller's for
+// scoped handlers, none for handlers shared by every tenant
+func (cp *CrudP) changeTenant(handler actionHandler, data ...any) string {
+	if !handler.tenantScoped {
+		return ""
+	}
+	return cp.tenantOf(data...)
+}
+
+// tenantOf returns the tenant of a call: the TenantKey of the injected
+// context, else the resolver. Empty when multi-tenancy is disabled.
+func (cp *CrudP) tenantOf(data ...any) string {
+	if cp.getTenant == nil {
+		return ""
+	}
+	if tenant := contextFrom(data).Value(TenantKey); tenant != "" {
+		return tenant
+	}
+	return cp.getTenant(data...)
+}
+
+// withTenant binds the CRUD methods of the handler's ForTenant instance
+func (h actionHandler) withTenant(tenant string) (actionHandler, error) {
+	if tenant == "" {
+		return h, &StatusError{Code: 400, Message: "tenant required"}
+	}
+	if h.forTenant == nil {
+		return h, nil
+	}
+	scoped := h.forTenant(tenant)
+	if scoped == nil {
+		return h, &StatusError{Code: 404, Message: "unknown tenant"}
+	}
+	h.bind(scoped)
+	return h, nil
+}
+
+// ownedBy reports whether entity belongs to tenant; entities that are not
+// TenantOwned belong to every tenant
+func ownedBy(entity any, tenant string) bool {
+	owned, ok := entity.(TenantOwned)
+	return !ok || owned.TenantID() == tenant
+}
+
+// logDenied logs an access denial, with the tenant when there is one
+func (cp *CrudP) logDenied(handler string, data ...any) {
+	if tenant := cp.tenantOf(data...); tenant != "" {
+		cp.log("access denied for handler:", handler, "tenant:", tenant)
+		return
+	}
+	cp.log("access denied for handler:", handler)
+}
+
+// withTenantNote appends the tenant to access-denied messages
+func (cp *CrudP) withTenantNote(msg string, data ...any) string {
+	if tenant := cp.tenantOf(data...); tenant != "" {
+		return msg + " (tenant " + tenant + ")"
+	}
+	return msg
+}
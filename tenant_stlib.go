@@ -0,0 +1,56 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"net"
+	"net/http"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// TenantFromHeader returns a tenant resolver reading the named request
+// header. The client chooses the header: pair it with SetTenantAuthorizer.
+func TenantFromHeader(name string) func(data ...any) string {
+	return func(data ...any) string {
+		if r := requestFrom(data); r != nil {
+			return Convert(r.Header.Get(name)).TrimSpace().String()
+		}
+		return ""
+	}
+}
+
+// TenantFromSubdomain returns a tenant resolver reading the subdomain of
+// domain in the request host: "acme" for acme.example.com with domain
+// "example.com". Deeper or missing subdomains resolve to no tenant. Like a
+// header, the host is chosen by the client: pair it with SetTenantAuthorizer.
+func TenantFromSubdomain(domain string) func(data ...any) string {
+	suffix := "." + domain
+	return func(data ...any) string {
+		r := requestFrom(data)
+		if r == nil {
+			return ""
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !HasSuffix(host, suffix) {
+			return ""
+		}
+		sub := host[:len(host)-len(suffix)]
+		if sub == "" || Contains(sub, ".") {
+			return ""
+		}
+		return sub
+	}
+}
+
+func requestFrom(data []any) *http.Request {
+	for _, d := range data {
+		if r, ok := d.(*http.Request); ok {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tinywasm/crudp"
+)
+
+type Visit struct {
+	ID     string `json:"id"`
+	Clinic string `json:"clinic"`
+	Note   string `json:"note"`
+
+	tenant string // Set by ForTenant
+}
+
+var visitStore map[string]*Visit
+
+// boundTenant records the tenant of the last ForTenant instance used
+var boundTenant string
+
+func (v *Visit) HandlerName() string { return "visits" }
+func (v *Visit) TenantID() string    { return v.Clinic }
+func (v *Visit) ForTenant(tenant string) any {
+	if tenant == "ghost" {
+		return nil
+	}
+	return &Visit{tenant: tenant}
+}
+func (v *Visit) Read(id string) (any, error) {
+	boundTenant = v.tenant
+	if stored, ok := visitStore[id]; ok {
+		return stored, nil
+	}
+	return nil, &crudp.StatusError{Code: 404, Message: "not found"}
+}
+
+// List ignores the tenant on purpose: isolation must not depend on it
+func (v *Visit) List() (any, error) {
+	boundTenant = v.tenant
+	return []*Visit{visitStore["1"], visitStore["2"], visitStore["3"]}, nil
+}
+func (v *Visit) Create(payload any) (any, error) {
+	visit := payload.(*Visit)
+	visitStore[visit.ID] = visit
+	return visit, nil
+}
+func (v *Visit) Update(payload any) (any, error) {
+	visit := payload.(*Visit)
+	visitStore[visit.ID] = visit
+	return visit, nil
+}
+func (v *Visit) ValidateData(byte, any) error    { return nil }
+func (v *Visit) AllowedRoles(action byte) []byte { return []byte{'*'} }
+func (v *Visit) CacheReads() bool                { return true }
+
+func TestTenancy(t *testing.T) {
+	visitStore = map[string]*Visit{
+		"1": {ID: "1", Clinic: "acme", Note: "a"},
+		"2": {ID: "2", Clinic: "globex", Note: "b"},
+		"3": {ID: "3", Clinic: "acme", Note: "c"},
+	}
+	cp := NewTestCrudP()
+	cp.SetDevMode(false)
+	cp.SetUserRoles(func(data ...any) []byte { return []byte{'u'} })
+	cp.SetUserID(func(data ...any) string {
+		for _, d := range data {
+			if r, ok := d.(*http.Request); ok {
+				return r.Header.Get("X-User")
+			}
+		}
+		return ""
+	})
+	cp.SetTenantResolver(crudp.TenantFromHeader("X-Tenant"))
+	members := map[string]string{"ann": "acme", "gus": "globex", "gil": "ghost"}
+	cp.SetTenantAuthorizer(func(userID, tenant string) bool { return members[userID] == tenant })
+	cp.SetChangeLog(crudp.NewMemoryChangeLog(100))
+	if err := cp.RegisterHandlers(&Visit{}, &Doc{}); err != nil {
+		t.Fatalf("RegisterHandlers failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	cp.RegisterRoutes(mux)
+
+	userOf := map[string]string{"acme": "ann", "globex": "gus", "ghost": "gil"}
+	send := func(user, tenant string, req *http.Request) *httptest.ResponseRecorder {
+		req.Header.Set("X-User", user)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	batch := func(tenant string, packets ...crudp.Packet) crudp.BatchResponse {
+		var body []byte
+		jsonEncode(&crudp.BatchRequest{Packets: packets}, &body)
+		rec := send(userOf[tenant], tenant, httptest.NewRequest("POST", "/batch", bytes.NewReader(body)))
+		var resp crudp.BatchResponse
+		jsonDecode(rec.Body.Bytes(), &resp)
+		return resp
+	}
+	do := func(tenant, method, path string, visit *Visit) (int, crudp.Response) {
+		var body []byte
+		if visit != nil {
+			var data []byte
+			jsonEncode(visit, &data)
+			jsonEncode(crudp.Request{Data: [][]byte{data}}, &body)
+		}
+		rec := send(userOf[tenant], tenant, httptest.NewRequest(method, path, bytes.NewReader(body)))
+		var resp crudp.Response
+		jsonDecode(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	t.Run("Reads Are Isolated", func(t *testing.T) {
+		_, resp := do("acme", "GET", "/visits/", nil)
+		if len(resp.Data) != 2 {
+			t.Errorf("expected 2 acme visits, got %d", len(resp.Data))
+		}
+		if boundTenant != "acme" {
+			t.Errorf("expected the handler bound to acme, got %q", boundTenant)
+		}
+		if code, _ := do("acme", "GET", "/visits/2", nil); code != http.StatusNotFound {
+			t.Errorf("another tenant's visit: expected 404, got %d", code)
+		}
+		if code, _ := do("globex", "GET", "/visits/2", nil); code != http.StatusOK {
+			t.Errorf("own visit: expected 200, got %d", code)
+		}
+	})
+
+	t.Run("Cached Reads Are Not Shared", func(t *testing.T) {
+		if code, _ := do("acme", "GET", "/visits/1", nil); code != http.StatusOK {
+			t.Fatalf("own visit: expected 200, got %d", code)
+		}
+		if code, _ := do("globex", "GET", "/visits/1", nil); code != http.StatusNotFound {
+			t.Errorf("another tenant's visit after a cached read: expected 404, got %d", code)
+		}
+	})
+
+	t.Run("Writes Cannot Cross Tenants", func(t *testing.T) {
+		if code, _ := do("acme", "POST", "/visits/", &Visit{ID: "4", Clinic: "globex"}); code != http.StatusForbidden {
+			t.Errorf("create for another tenant: expected 403, got %d", code)
+		}
+		if code, _ := do("acme", "PUT", "/visits/2", &Visit{ID: "2", Clinic: "acme"}); code != http.StatusNotFound {
+			t.Errorf("update of another tenant's visit: expected 404, got %d", code)
+		}
+		if code, _ := do("acme", "PUT", "/visits/1", &Visit{ID: "2", Clinic: "acme", Note: "hijacked"}); code != http.StatusBadRequest {
+			t.Errorf("update with another id in the payload: expected 400, got %d", code)
+		}
+		if visitStore["2"].Clinic != "globex" {
+			t.Error("another tenant's visit must not be modified")
+		}
+		if code, _ := do("acme", "POST", "/visits/", &Visit{ID: "4", Clinic: "acme"}); code != http.StatusOK {
+			t.Errorf("create for own tenant: expected 200, got %d", code)
+		}
+	})
+
+	t.Run("Unverifiable Writes Are Rejected", func(t *testing.T) {
+		if code, _ := do("acme", "PUT", "/visits/9", &Visit{ID: "9", Clinic: "acme"}); code != http.StatusNotFound {
+			t.Errorf("update of an unreadable visit: expected 404, got %d", code)
+		}
+		if _, ok := visitStore["9"]; ok {
+			t.Error("an unreadable visit must not be written")
+		}
+
+		var data []byte
+		jsonEncode(&Visit{Clinic: "acme"}, &data)
+		resp := batch("acme", crudp.Packet{Action: 'u', ReqID: "u1", Data: [][]byte{data}})
+		if len(resp.Results) != 1 || resp.Results[0].Status != http.StatusBadRequest {
+			t.Errorf("update without an id: expected 400, got %+v", resp.Results)
+		}
+	})
+
+	t.Run("Sync Is Isolated", func(t *testing.T) {
+		if code, _ := do("globex", "PUT", "/visits/2", &Visit{ID: "2", Clinic: "globex", Note: "x"}); code != http.StatusOK {
+			t.Fatalf("update of own visit: expected 200, got %d", code)
+		}
+
+		resp := batch("globex", crudp.Packet{Action: 's', ReqID: "y1"})
+		if len(resp.Results) != 2 || resp.Results[1].Action != 's' {
+			t.Fatalf("expected one synced visit and the cursor, got %+v", resp.Results)
+		}
+		var visit Visit
+		if jsonDecode(resp.Results[0].Data[0], &visit); visit.ID != "2" || visit.Clinic != "globex" {
+			t.Errorf("expected only globex visits synced, got %+v", visit)
+		}
+	})
+
+	t.Run("Tenant Required", func(t *testing.T) {
+		sink := &memoryAudit{}
+		cp.SetAuditSink(sink)
+		defer cp.SetAuditSink(nil)
+
+		if code, _ := do("", "GET", "/visits/", nil); code != http.StatusBadRequest {
+			t.Errorf("expected 400 without a tenant, got %d", code)
+		}
+		if len(sink.entries) != 1 || !sink.entries[0].Denied {
+			t.Errorf("expected the call audited as denied, got %+v", sink.entries)
+		}
+		if code, _ := do("ghost", "GET", "/visits/", nil); code != http.StatusNotFound {
+			t.Errorf("expected 404 for a tenant rejected by ForTenant, got %d", code)
+		}
+	})
+
+	t.Run("Membership Required", func(t *testing.T) {
+		if rec := send("ann", "globex", httptest.NewRequest("GET", "/visits/2", nil)); rec.Code != http.StatusForbidden {
+			t.Errorf("tenant the user does not belong to: expected 403, got %d", rec.Code)
+		}
+		if rec := send("ann", "globex", httptest.NewRequest("GET", "/changes?since=0", nil)); rec.Code != http.StatusForbidden {
+			t.Errorf("change feed of another tenant: expected 403, got %d", rec.Code)
+		}
+
+		cp.SetTenantAuthorizer(nil)
+		defer cp.SetTenantAuthorizer(func(userID, tenant string) bool { return members[userID] == tenant })
+		if code, _ := do("acme", "GET", "/visits/1", nil); code != http.StatusForbidden {
+			t.Errorf("without an authorizer: expected 403, got %d", code)
+		}
+	})
+
+	t.Run("Shared Handlers Are Not Tagged", func(t *testing.T) {
+		docStore = map[string]*Doc{"1": {ID: "1", Rev: 1}}
+		var data []byte
+		jsonEncode(&Doc{ID: "1", Rev: 1, Txt: "shared"}, &data)
+		if res := batch("acme", crudp.Packet{Action: 'u', HandlerID: 1, ReqID: "u1", Data: [][]byte{data}}).Results[0]; res.Status != 0 {
+			t.Fatalf("update of a shared doc failed: %+v", res)
+		}
+		resp := batch("globex", crudp.Packet{Action: 's', HandlerID: 1, ReqID: "y1"})
+		if len(resp.Results) != 2 || resp.Results[0].Action != 'u' {
+			t.Errorf("expected the shared change synced to another tenant, got %+v", resp.Results)
+		}
+	})
+
+	t.Run("Subdomain Resolver", func(t *testing.T) {
+		resolve := crudp.TenantFromSubdomain("example.com")
+		for host, want := range map[string]string{
+			"acme.example.com":      "acme",
+			"acme.example.com:8080": "acme",
+			"example.com":           "",
+			"a.b.example.com":       "",
+			"acme.other.com":        "",
+		} {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Host = host
+			if got := resolve(req); got != want {
+				t.Errorf("%s: expected %q, got %q", host, want, got)
+			}
+		}
+	})
+}